@@ -1,103 +1,161 @@
 package attestor
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"strings"
+	"time"
 
+	"janeauto/config"
 	"janeauto/models"
 	"janeauto/jane"
 )
 
-func unique(items []string) []string {
-	seen := make(map[string]struct{})
-	var result []string
-	for _, i := range items {
-		if _, ok := seen[i]; !ok {
-			seen[i] = struct{}{}
-			result = append(result, i)
-		}
-	}
-	return result
+// ruleOutcome is what running the rules of one attestation amounts to
+type ruleOutcome struct {
+	Status      string
+	RuleResults []map[string]interface{}
+	Warnings    []string
+	StoppedBy   string // the fail-fast rule that failed, if any
 }
 
-func runRules(janeURL, claimID, sessionID string, rules []models.Rule) (bool, []map[string]interface{}) {
-	allPassed := true
-	ruleResults := []map[string]interface{}{}
+// runRules runs the rules on a claim in order. Each rule's Decision says how its status counts:
+// required and fail-fast rules make up the attestation's status, advisory rules only warn,
+// ignored rules are just recorded. A fail-fast rule that fails or errors skips the remaining rules.
+// An attestation without counting rules passes, since its claim was obtained.
+func runRules(ctx context.Context, client *jane.Client, codes models.ResultCodes, elementID, intent, claimID, sessionID string, rules []models.Rule) ruleOutcome {
+	trace := traceFrom(ctx)
+	out := ruleOutcome{RuleResults: []map[string]interface{}{}}
+	var counted []string
 
 	for _, rule := range rules {
+		decision := rule.EffectiveDecision()
+		if out.StoppedBy != "" {
+			out.RuleResults = append(out.RuleResults, map[string]interface{}{
+				"rule":		rule.Name,
+				"status":	models.StatusSkipped,
+				"decision":	decision,
+			})
+			trace.ruleVerdict(elementID, intent, rule.Name, models.StatusSkipped)
+			continue
+		}
+
 		fmt.Printf("[DEBUG] Running rule: %s on claim %s\n", rule.Name, claimID)
 
-		resultID,resultCode, passed, err := jane.RunVerification(janeURL, claimID, rule.Name, sessionID)
+		var status string
+		resultID,resultCode, _, err := client.RunVerification(ctx, claimID, rule.Name, sessionID, rule.Parameter)
 		if err != nil {
 			fmt.Printf("[ERROR] Failed to run rule %s: %v\n", rule.Name, err)
-			ruleResults = append(ruleResults, map[string]interface{}{
+			status = models.StatusError
+			out.RuleResults = append(out.RuleResults, map[string]interface{}{
 				"rule":		rule.Name,
-				"status":	"error",
+				"status":	status,
+				"decision":	decision,
 				"error":	err.Error(),
+				"error_kind":	resultError(err).Kind,
 			})
-			allPassed = false
-			continue
-		}
+		} else {
+			// Determines status based on result code
+			meaning := codes.Lookup(resultCode)
+			status = meaning.Status
 
-		// Determines status based on result code
-		status := "pass"
-		if !passed {
-			if resultCode == 9098 { //treats this specific code as "error"
-				status = "error"
-			} else {
-				status = "fail"
+			out.RuleResults = append(out.RuleResults, map[string]interface{}{
+				"rule":		rule.Name,
+				"status":	status,
+				"decision":	decision,
+				"passed":	status == models.StatusPass,
+				"code":		resultCode,
+				"explanation":	meaning.Explanation,
+				"severity":	meaning.Severity,
+				"result_id":	resultID,
+			})
+			if resultID != "" {
+				addResultDetails(ctx, client, resultID, out.RuleResults[len(out.RuleResults)-1])
 			}
 		}
+		trace.ruleVerdict(elementID, intent, rule.Name, status)
 
-		ruleResults = append(ruleResults, map[string]interface{}{
-			"rule":		rule.Name,
-			"status":	status,
-			"passed":	passed,
-			"result_id":	resultID,
-		})
-
-		if !passed {
-			allPassed = false
+		switch decision {
+		case models.DecisionAdvisory:
+			if status != models.StatusPass {
+				out.Warnings = append(out.Warnings, fmt.Sprintf("advisory rule %s: %s", rule.Name, status))
+			}
+		case models.DecisionIgnore:
+		case models.DecisionFailFast:
+			counted = append(counted, status)
+			if status == models.StatusFail || status == models.StatusError {
+				out.StoppedBy = rule.Name
+			}
+		default:
+			counted = append(counted, status)
 		}
 	}
 
-	return allPassed, ruleResults
+	out.Status = models.Rollup(counted...)
+	if out.Status == "" {
+		out.Status = models.StatusPass
+	}
+	return out
 }
 
-// ExecutePolicy runs the entire attestation process for any given policy.
-// Returns results, sessionID
-func ExecutePolicy(policy *models.Policy) ([]models.AttestationResult, string, error) {
-	fmt.Printf("\n=== EXECUTING POLICY: %s ===\n", policy.Name)
-
-	janeURL := policy.Jane
+// keys JANE and its rules use in result documents for the message and the compared values
+var (
+	messageKeys  = []string{"message", "msg", "reason"}
+	expectedKeys = []string{"expected", "expectedvalue", "expected_value"}
+	actualKeys   = []string{"actual", "actualvalue", "actual_value", "received"}
+)
 
-	// Fetches intents from JANE
-	fmt.Printf("[DEBUG] Fetching intents from: %s\n", janeURL+"/intents")
-	resp, err := http.Get(janeURL + "/intents")
+// addResultDetails fetches a verification's result document and copies its message
+// and expected-vs-actual values onto the rule result
+func addResultDetails(ctx context.Context, client *jane.Client, resultID string, ruleResult map[string]interface{}) {
+	doc, err := client.GetResult(ctx, resultID)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to fetch intents: %v", err)
+		fmt.Printf("[WARNING] Could not fetch result %s: %v\n", resultID, err)
+		ruleResult["result_error"] = err.Error()
+		return
 	}
-	defer resp.Body.Close()
-
-	bodyBytes, _ := ioutil.ReadAll(resp.Body)
-	resp.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+	if v, ok := lookupKey(doc, messageKeys); ok {
+		ruleResult["message"] = v
+	}
+	if v, ok := lookupKey(doc, expectedKeys); ok {
+		ruleResult["expected"] = v
+	}
+	if v, ok := lookupKey(doc, actualKeys); ok {
+		ruleResult["actual"] = v
+	}
+}
 
-	var intentData struct {
-		Intents []string `json:"intents"`
+// lookupKey returns the value of the first of keys found in doc, ignoring case.
+// Values nested in the document's "parameters" or "additionalinfo" objects are found too.
+func lookupKey(doc map[string]interface{}, keys []string) (interface{}, bool) {
+	for _, key := range keys {
+		for k, v := range doc {
+			if strings.EqualFold(k, key) && v != nil {
+				return v, true
+			}
+		}
+	}
+	for k, v := range doc {
+		if nested, ok := v.(map[string]interface{}); ok && (strings.EqualFold(k, "parameters") || strings.EqualFold(k, "additionalinfo")) {
+			if v, ok := lookupKey(nested, keys); ok {
+				return v, true
+			}
+		}
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&intentData); err != nil {
-		return nil, "", fmt.Errorf("failed to decode intents: %v", err)
+	return nil, false
+}
+
+// resolveIntents builds the map from intent name, with spaces removed, to the intent's ItemID on JANE
+func resolveIntents(ctx context.Context, client *jane.Client) (map[string]string, error) {
+	intents, err := client.ListIntents(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	// builds intent name -> itemID map
 	intentNameToItemID := make(map[string]string)
-	for _, intentName := range intentData.Intents {
+	for _, intentName := range intents {
 		normalizedName := strings.ReplaceAll(intentName, " ", "")
-		itemID, err := jane.GetIntentItemID(janeURL, normalizedName)
+		itemID, err := client.GetIntentItemID(ctx, normalizedName)
 		if err != nil {
 			fmt.Printf("[WARNING] Could not get ItemID for intent '%s': %v\n", normalizedName, err)
 		} else {
@@ -105,111 +163,168 @@ func ExecutePolicy(policy *models.Policy) ([]models.AttestationResult, string, e
 		}
 	}
 	fmt.Printf("[DEBUG] Intent map has %d entries\n", len(intentNameToItemID))
+	return intentNameToItemID, nil
+}
 
-	// Resolves element names to UUIDs and builds name map
-	var elementIDs []string
-	uuidToName := make(map[string]string)
+// JaneURL returns the JANE a policy runs against; policies without their own JANE use the configured one
+func JaneURL(policy *models.Policy) string {
+	if policy.Jane != "" {
+		return policy.Jane
+	}
+	return config.ConfigData.Jane.URL
+}
 
-	// Adds direct item IDs (if there are any) they have no name so we leave name empty
-	elementIDs = append(elementIDs, policy.Collection.Items...)
+// ExecutePolicy runs the entire attestation process for any given policy.
+// Returns results, sessionID. Cancelling ctx aborts the outstanding JANE calls.
+func ExecutePolicy(ctx context.Context, policy *models.Policy) ([]models.AttestationResult, string, error) {
+	fmt.Printf("\n=== EXECUTING POLICY: %s ===\n", policy.Name)
 
-	for _, name := range policy.Collection.Names {
-		fmt.Printf("[DEBUG] Looking for elements with name: %s\n", name)
-		ids, err := jane.GetElementsByName(janeURL, name)
-		if err != nil {
-			fmt.Printf("[WARNING] Could not resolve name '%s': %v\n", name, err)
-			continue
-		}
-		for _, id := range ids {
-		uuidToName[id] = name // stores mapping
-		elementIDs = append(elementIDs, ids...)
-		}
+	janeURL := JaneURL(policy)
+	client := jane.For(janeURL)
+
+	// Fetches intents from JANE
+	fmt.Printf("[DEBUG] Fetching intents from: %s\n", janeURL+"/intents")
+	intentNameToItemID, err := resolveIntents(ctx, client)
+	if err != nil {
+		return nil, "", err
 	}
-	elementIDs = unique(elementIDs)
 
-	// Filters empty IDs
-	var filtered []string
-	for _, id := range elementIDs {
-		if strings.TrimSpace(id) != "" {
-			filtered = append(filtered, id)
-		}
+	// Resolves items, names and tags into one set of target elements
+	targets := resolveTargets(ctx, client, policy.Collection)
+	fmt.Printf("[DEBUG] Targets: %d elements\n", len(targets))
+	trace := traceFrom(ctx)
+	elementIDs := make([]string, len(targets))
+	for i, t := range targets {
+		elementIDs[i] = t.ElementID
 	}
-	elementIDs = filtered
-	fmt.Printf("[DEBUG] ElementIDs (filtered): %v\n", elementIDs)
+	trace.elementsResolved(elementIDs)
 
 	// creates the jane session
-	sid, err := jane.CreateSession(janeURL)
+	sid, err := client.CreateSession(ctx)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to create JANE session: %v", err)
+		return nil, "", fmt.Errorf("failed to create JANE session: %w", err)
 	}
-	// ensures session is closed after we finish
-	defer jane.CloseSession(janeURL, sid)
+	trace.sessionCreated(sid)
+	// ensures session is closed after we finish, even if ctx was cancelled
+	defer func() {
+		if err := client.CloseSession(context.WithoutCancel(ctx), sid); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	// this is the main attestation loop, elements are attested concurrently
+	// and each element's results land in its own slot so the order stays stable
+	fmt.Printf("[DEBUG] Starting attestation loop. Elements: %d, Attestation: %d\n", len(targets), len(policy.Attestations))
+
+	codes := ResultCodesFor(policy)
+	perElement := make([][]models.AttestationResult, len(targets))
+	runErr := forEachConcurrently(ctx, janeURL, len(targets), func(ctx context.Context, i int) {
+		perElement[i] = attestElement(ctx, client, codes, sid, targets[i], policy.Attestations, intentNameToItemID)
+	})
 
-	// this is the main attestation loop
 	var results []models.AttestationResult
-	fmt.Printf("[DEBUG] Starting attestation loop. Elements: %d, Attestation: %d\n", len(elementIDs), len(policy.Attestations))
-
-	for _, eid := range elementIDs {
-		for _, attest := range policy.Attestations {
-			normalizedPolicyIntent := strings.ReplaceAll(attest.Intent, " ", "")
-			pid, ok := intentNameToItemID[normalizedPolicyIntent]
-
-			fmt.Printf("\n[ATTESTATION] Element: %s, Intent: %s -> Found ItemID: %s\n", eid, attest.Intent, pid)
-
-			if !ok {
-				fmt.Printf("[ERROR] Intent not found on JANE: %s\n", attest.Intent)
-				results = append(results, models.AttestationResult{
-					ElementID: 	eid,
-					ElementName:	uuidToName[eid], // can be empty 
-					Intent:    	attest.Intent,
-					Claim:     	map[string]interface{}{"error": "Intent not found on JANE"},
-					Passed:    	false,
-				})
-				continue
-			}
+	for _, r := range perElement {
+		results = append(results, r...)
+	}
 
-			// runs the attestation part
-			claimID, err := jane.RunAttestation(janeURL, eid, pid, attest.Endpoint, sid)
-			if err != nil {
-				results = append(results, models.AttestationResult{
-					ElementID: 	eid,
-					ElementName: 	uuidToName[eid],
-					Intent:    	attest.Intent,
-					Claim:     	map[string]interface{}{"error": err.Error()},
-					Passed:    	false,
-				})
-				continue
-			}
+	fmt.Printf("[DEBUG] Total results: %d\n", len(results))
+	if runErr != nil {
+		return results, sid, fmt.Errorf("policy run cancelled: %w", runErr)
+	}
+	if hitBreaker(results) {
+		return results, sid, fmt.Errorf("JANE at %s became unavailable during the run: %w", janeURL, jane.ErrCircuitOpen)
+	}
+	return results, sid, nil
+}
 
-			// retrieves the claim
-			claim, err := jane.GetClaim(janeURL, claimID)
-			if err != nil {
-				results = append(results, models.AttestationResult{
-					ElementID: 	eid,
-					ElementName: 	uuidToName[eid],
-					Intent:    	attest.Intent,
-					Claim:     	map[string]interface{}{"error": err.Error()},
-					Passed:    	false,
-				})
-				continue
-			}
+// attestElement runs every attestation of the policy against one element, in policy order.
+// Once a fail-fast rule fails, the remaining attestations are recorded as skipped.
+func attestElement(ctx context.Context, client *jane.Client, codes models.ResultCodes, sid string, t target, attestations []models.AttestItem, intentNameToItemID map[string]string) []models.AttestationResult {
+	eid := t.ElementID
+	trace := traceFrom(ctx)
+	var results []models.AttestationResult
+	add := func(r models.AttestationResult) {
+		r.Time = time.Now()
+		r.ElementID = eid
+		r.ElementName = t.ElementName // can be empty
+		r.SelectedBy = t.SelectedBy
+		r.Passed = r.Status == models.StatusPass
+		results = append(results, r)
+		trace.resultReady(r)
+	}
 
-			// runs all rules for this attestation
-			passed, ruleResults := runRules(janeURL, claimID, sid, attest.Rules)
+	stoppedBy := ""
+	for _, attest := range attestations {
+		if stoppedBy != "" {
+			add(models.AttestationResult{
+				Intent:    attest.Intent,
+				Claim:     map[string]interface{}{"skipped": "fail-fast rule " + stoppedBy + " failed"},
+				Status:    models.StatusSkipped,
+				StoppedBy: stoppedBy,
+			})
+			continue
+		}
+
+		normalizedPolicyIntent := strings.ReplaceAll(attest.Intent, " ", "")
+		pid, ok := intentNameToItemID[normalizedPolicyIntent]
+
+		fmt.Printf("\n[ATTESTATION] Element: %s, Intent: %s -> Found ItemID: %s\n", eid, attest.Intent, pid)
 
-			// saves the results
-			results = append(results, models.AttestationResult{
-				ElementID:   eid,
-				ElementName: uuidToName[eid],
+		if !ok {
+			fmt.Printf("[ERROR] Intent not found on JANE: %s\n", attest.Intent)
+			add(models.AttestationResult{
+				Intent: attest.Intent,
+				Claim:  map[string]interface{}{"error": "Intent not found on JANE"},
+				Status: models.StatusError,
+				Error:  &models.ResultError{Kind: models.ErrorKindNotFound, Message: "Intent not found on JANE"},
+			})
+			continue
+		}
+
+		// runs the attestation part
+		trace.attestationStarted(eid, attest.Intent)
+		claimID, err := client.RunAttestation(ctx, eid, pid, attest.Endpoint, sid, attest.Parameters)
+		if err != nil {
+			add(models.AttestationResult{
+				Intent: attest.Intent,
+				Claim:  map[string]interface{}{"error": err.Error()},
+				Status: models.StatusError,
+				Error:  resultError(err),
+			})
+			continue
+		}
+
+		// waits for the claim
+		claim, waited, err := client.WaitForClaim(ctx, claimID, claimWaitFor(attest.Intent))
+		if err != nil {
+			add(models.AttestationResult{
 				Intent:      attest.Intent,
-				Claim:       claim,
-				Passed:      passed,
-				RuleResults: ruleResults,
+				Claim:       map[string]interface{}{"error": err.Error()},
+				Status:      models.StatusError,
 				ClaimID:     claimID,
+				ClaimWaitMs: waited.Milliseconds(),
+				Error:       resultError(err),
 			})
+			continue
 		}
-	}
 
-	fmt.Printf("[DEBUG] Total results: %d\n", len(results))
-	return results, sid, nil
+		trace.claimFetched(eid, attest.Intent, claimID)
+
+		// runs all rules for this attestation
+		outcome := runRules(ctx, client, codes, eid, attest.Intent, claimID, sid, attest.Rules)
+
+		// saves the results
+		add(models.AttestationResult{
+			Intent:      attest.Intent,
+			Claim:       claim,
+			Status:      outcome.Status,
+			RuleResults: outcome.RuleResults,
+			ClaimID:     claimID,
+			ClaimWaitMs: waited.Milliseconds(),
+			Warnings:    outcome.Warnings,
+			StoppedBy:   outcome.StoppedBy,
+		})
+		stoppedBy = outcome.StoppedBy
+	}
+	return results
 }
@@ -0,0 +1,469 @@
+package attestor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"janeauto/jane"
+	"janeauto/janetest"
+	"janeauto/models"
+)
+
+// fakeJane scripts a JANE with two web servers tagged prod, one database and a few rules
+func fakeJane(t *testing.T) *janetest.Server {
+	t.Helper()
+	srv := janetest.New(t)
+	srv.AddElement("e1", "web01", "prod", "web")
+	srv.AddElement("e2", "web02", "prod", "web")
+	srv.AddElement("e3", "db01", "prod")
+	srv.AddIntent("i1", "sys info")
+	srv.AddIntent("i2", "tpm quote")
+	srv.AddRule("ok", 0)
+	srv.AddRule("bad", 9001)
+	srv.AddRule("unsure", 9098)
+	return srv
+}
+
+func statuses(results []models.AttestationResult) string {
+	var out []string
+	for _, r := range results {
+		out = append(out, r.ElementID+":"+r.Intent+"="+r.Status)
+	}
+	return strings.Join(out, " ")
+}
+
+func TestExecutePolicy(t *testing.T) {
+	srv := fakeJane(t)
+	policy := &models.Policy{
+		Name:       "web",
+		Jane:       srv.URL,
+		Collection: models.PolicyCollection{Names: []string{"web01"}, Tags: []string{"web"}},
+		Attestations: []models.AttestItem{
+			{Intent: "sys info", Endpoint: "tarzan", Rules: []models.Rule{
+				{Name: "ok"},
+				{Name: "bad", Decision: models.DecisionAdvisory},
+			}},
+			{Intent: "tpm quote", Endpoint: "tarzan", Rules: []models.Rule{{Name: "bad"}}},
+		},
+	}
+
+	results, sid, err := ExecutePolicy(context.Background(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sid == "" {
+		t.Error("no session ID returned")
+	}
+	want := "e1:sys info=pass e1:tpm quote=fail e2:sys info=pass e2:tpm quote=fail"
+	if got := statuses(results); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	if got := results[0].SelectedBy; len(got) != 2 {
+		t.Errorf("e1 is selected by name and tag, got %v", got)
+	}
+	if results[0].ClaimWaitMs < 0 || results[0].ClaimID == "" {
+		t.Errorf("claim: %+v", results[0])
+	}
+	if results[0].ElementName != "web01" {
+		t.Errorf("element name: got %q", results[0].ElementName)
+	}
+	if n := WarningCount(results); n != 2 {
+		t.Errorf("got %d warnings, want 2 from the advisory rule", n)
+	}
+	if v := Verdict(results, nil); v != models.VerdictFail {
+		t.Errorf("verdict: got %s", v)
+	}
+	if n := srv.OpenSessions(); n != 0 {
+		t.Errorf("%d sessions left open", n)
+	}
+}
+
+func TestExecutePolicyWarnVerdict(t *testing.T) {
+	srv := fakeJane(t)
+	policy := &models.Policy{
+		Name:       "warn",
+		Jane:       srv.URL,
+		Collection: models.PolicyCollection{Items: []string{"e3"}},
+		Attestations: []models.AttestItem{{Intent: "sys info", Endpoint: "tarzan", Rules: []models.Rule{
+			{Name: "ok"},
+			{Name: "bad", Decision: models.DecisionAdvisory},
+			{Name: "bad", Decision: models.DecisionIgnore},
+		}}},
+	}
+
+	results, _, err := ExecutePolicy(context.Background(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := Verdict(results, nil); v != models.VerdictWarn {
+		t.Errorf("verdict: got %s, want warn", v)
+	}
+	if n := len(results[0].RuleResults); n != 3 {
+		t.Errorf("got %d rule results, want 3", n)
+	}
+}
+
+func TestFailFastSkipsTheRest(t *testing.T) {
+	srv := fakeJane(t)
+	policy := &models.Policy{
+		Name:       "failfast",
+		Jane:       srv.URL,
+		Collection: models.PolicyCollection{Items: []string{"e1"}},
+		Attestations: []models.AttestItem{
+			{Intent: "sys info", Endpoint: "tarzan", Rules: []models.Rule{
+				{Name: "bad", Decision: models.DecisionFailFast},
+				{Name: "ok"},
+			}},
+			{Intent: "tpm quote", Endpoint: "tarzan", Rules: []models.Rule{{Name: "ok"}}},
+		},
+	}
+
+	results, _, err := ExecutePolicy(context.Background(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := statuses(results); got != "e1:sys info=fail e1:tpm quote=skipped" {
+		t.Errorf("got %s", got)
+	}
+	if rr := results[0].RuleResults; rr[1]["status"] != models.StatusSkipped {
+		t.Errorf("rule after the fail-fast failure: got %v", rr[1])
+	}
+	if n := srv.Count("/attest"); n != 1 {
+		t.Errorf("got %d /attest calls, want 1", n)
+	}
+	for _, r := range results {
+		if r.StoppedBy != "bad" {
+			t.Errorf("%s: stopped by %q, want the fail-fast rule", r.Intent, r.StoppedBy)
+		}
+	}
+}
+
+func TestResultCodesAndDetails(t *testing.T) {
+	srv := fakeJane(t)
+	srv.SetRule(janetest.Rule{Name: "kernel", Code: 9001, Details: map[string]interface{}{
+		"message":        "kernel too old",
+		"additionalinfo": map[string]interface{}{"expected": "6.1", "actual": "5.4"},
+	}})
+	policy := &models.Policy{
+		Name:        "codes",
+		Jane:        srv.URL,
+		Collection:  models.PolicyCollection{Items: []string{"e1"}},
+		ResultCodes: models.ResultCodes{9001: {Status: models.StatusError, Explanation: "could not tell"}},
+		Attestations: []models.AttestItem{{Intent: "sys info", Endpoint: "tarzan", Rules: []models.Rule{
+			{Name: "kernel"},
+			{Name: "unsure"},
+		}}},
+	}
+
+	results, _, err := ExecutePolicy(context.Background(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kernel, unsure := results[0].RuleResults[0], results[0].RuleResults[1]
+	if kernel["status"] != models.StatusError || kernel["explanation"] != "could not tell" {
+		t.Errorf("policy result code not applied: %v", kernel)
+	}
+	if kernel["message"] != "kernel too old" || kernel["expected"] != "6.1" || kernel["actual"] != "5.4" {
+		t.Errorf("result details not copied: %v", kernel)
+	}
+	// 9098 is not configured in these tests, so it is an unknown code
+	if unsure["status"] != models.StatusFail {
+		t.Errorf("unknown result code: got %v", unsure)
+	}
+}
+
+func TestJaneFailures(t *testing.T) {
+	srv := fakeJane(t)
+	policy := &models.Policy{
+		Name:       "failures",
+		Jane:       srv.URL,
+		Collection: models.PolicyCollection{Items: []string{"e1", "unknown-element"}},
+		Attestations: []models.AttestItem{
+			{Intent: "sys info", Endpoint: "tarzan", Rules: []models.Rule{{Name: "ok"}, {Name: "no-such-rule"}}},
+			{Intent: "not on jane", Endpoint: "tarzan"},
+		},
+	}
+
+	results, _, err := ExecutePolicy(context.Background(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "e1:sys info=error e1:not on jane=error unknown-element:sys info=error unknown-element:not on jane=error"
+	if got := statuses(results); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	if e := results[1].Error; e == nil || e.Kind != models.ErrorKindNotFound {
+		t.Errorf("missing intent: got error %+v", e)
+	}
+	if e := results[2].Error; e == nil || e.Kind != models.ErrorKindJane || e.Endpoint != "/attest" {
+		t.Errorf("unknown element: got error %+v", e)
+	}
+	if kind := results[0].RuleResults[1]["error_kind"]; kind != models.ErrorKindJane {
+		t.Errorf("unknown rule: got error kind %v", kind)
+	}
+
+	// session creation is retried, so a single 503 goes unnoticed
+	srv.Fail("/session", http.StatusServiceUnavailable, `{"error": "busy"}`, 1)
+	if _, _, err := ExecutePolicy(context.Background(), policy); err != nil {
+		t.Errorf("want the session retried, got %v", err)
+	}
+	srv.Fail("/session", http.StatusServiceUnavailable, `{"error": "busy"}`, 0)
+	if _, _, err := ExecutePolicy(context.Background(), policy); err == nil || !strings.Contains(err.Error(), "busy") {
+		t.Errorf("want the session error, got %v", err)
+	}
+}
+
+func TestCircuitBreakerFailsTheRunFast(t *testing.T) {
+	jane.Configure(jane.WithRetry(jane.RetryPolicy{Attempts: 1}), jane.WithBreaker(2, time.Minute))
+	defer jane.Configure()
+	srv := fakeJane(t)
+	srv.Fail("/attest", http.StatusBadGateway, "", 0)
+	policy := &models.Policy{
+		Name:         "down",
+		Jane:         srv.URL,
+		Collection:   models.PolicyCollection{Tags: []string{"prod"}},
+		Attestations: []models.AttestItem{{Intent: "sys info", Endpoint: "tarzan"}, {Intent: "tpm quote", Endpoint: "tarzan"}},
+	}
+
+	results, _, err := ExecutePolicy(context.Background(), policy)
+	if !errors.Is(err, jane.ErrCircuitOpen) {
+		t.Fatalf("want ErrCircuitOpen, got %v", err)
+	}
+	// elements run concurrently, so a few calls may be in flight when the breaker opens
+	if n := srv.Count("/attest"); n >= len(results) {
+		t.Errorf("JANE got %d /attest calls for %d results, the breaker did not open", n, len(results))
+	}
+	if e := results[len(results)-1].Error; e == nil || e.Kind != models.ErrorKindCircuitOpen {
+		t.Errorf("last result: got error %+v", e)
+	}
+}
+
+func TestClaimWaitPerIntent(t *testing.T) {
+	ConfigureClaimWaits(map[string]jane.ClaimWait{"tpm quote": {Timeout: 150 * time.Millisecond, Interval: 20 * time.Millisecond}})
+	defer ConfigureClaimWaits(nil)
+	srv := fakeJane(t)
+	srv.ClaimDelay(3)
+	policy := &models.Policy{
+		Name:       "claims",
+		Jane:       srv.URL,
+		Collection: models.PolicyCollection{Items: []string{"e1"}},
+		Attestations: []models.AttestItem{
+			{Intent: "sys info", Endpoint: "tarzan"},
+			{Intent: "tpm quote", Endpoint: "tarzan"},
+		},
+	}
+	results, _, err := ExecutePolicy(context.Background(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := statuses(results); got != "e1:sys info=pass e1:tpm quote=pass" {
+		t.Fatalf("got %s", got)
+	}
+	// sys info uses the client's wait, whose first interval is 100ms
+	if w := results[0].ClaimWaitMs; w < 100 {
+		t.Errorf("sys info claim took %dms, want the wait recorded", w)
+	}
+
+	srv.ClaimDelay(1000)
+	policy.Attestations = policy.Attestations[1:]
+	results, _, _ = ExecutePolicy(context.Background(), policy)
+	if e := results[0].Error; e == nil || e.Kind != models.ErrorKindTimeout {
+		t.Errorf("tpm quote: got error %+v, want a timeout", e)
+	}
+	if w := results[0].ClaimWaitMs; w < 150 || w > 1000 {
+		t.Errorf("tpm quote: waited %dms, want about 150", w)
+	}
+}
+
+func TestExecutePolicyCancelled(t *testing.T) {
+	srv := fakeJane(t)
+	srv.Delay("/attest", 5*time.Second)
+	policy := &models.Policy{
+		Name:         "slow",
+		Jane:         srv.URL,
+		Collection:   models.PolicyCollection{Items: []string{"e1", "e2"}},
+		Attestations: []models.AttestItem{{Intent: "sys info", Endpoint: "tarzan", Rules: []models.Rule{{Name: "ok"}}}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err := ExecutePolicy(ctx, policy)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want the context error, got %v", err)
+	}
+	if d := time.Since(start); d > 3*time.Second {
+		t.Errorf("cancelling took %v", d)
+	}
+	if n := srv.OpenSessions(); n != 0 {
+		t.Errorf("%d sessions left open", n)
+	}
+}
+
+func TestForEachConcurrentlyPassesPanicsOn(t *testing.T) {
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("want the element's panic on the caller, got %v", r)
+		}
+	}()
+	forEachConcurrently(context.Background(), "http://jane.invalid", 3, func(ctx context.Context, i int) {
+		if i == 1 {
+			panic("boom")
+		}
+	})
+	t.Error("forEachConcurrently returned after a panic")
+}
+
+func TestResolveTargetsTagMatch(t *testing.T) {
+	srv := fakeJane(t)
+	client := jane.For(srv.URL)
+	ctx := context.Background()
+
+	or := resolveTargets(ctx, client, models.PolicyCollection{Tags: []string{"web", "prod"}})
+	if len(or) != 3 {
+		t.Errorf("or: got %d elements, want 3", len(or))
+	}
+	and := resolveTargets(ctx, client, models.PolicyCollection{Tags: []string{"web", "prod"}, TagMatch: models.TagMatchAnd})
+	if len(and) != 2 || and[0].ElementID != "e1" || and[1].ElementID != "e2" {
+		t.Errorf("and: got %v, want e1 and e2", and)
+	}
+}
+
+func TestPlanPolicy(t *testing.T) {
+	srv := fakeJane(t)
+	policy := &models.Policy{
+		Name:       "plan",
+		Jane:       srv.URL,
+		Collection: models.PolicyCollection{Names: []string{"web01", "nobody"}, Tags: []string{"web"}},
+		Attestations: []models.AttestItem{
+			{Intent: "sys info", Endpoint: "tarzan", Rules: []models.Rule{{Name: "ok"}, {Name: "bad"}}},
+			{Intent: "missing", Endpoint: "tarzan", Rules: []models.Rule{{Name: "ok"}}},
+		},
+	}
+
+	plan, err := PlanPolicy(context.Background(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Elements) != 2 || plan.AttestCalls != 2 || plan.VerifyCalls != 4 {
+		t.Errorf("got %d elements, %d attest and %d verify calls", len(plan.Elements), plan.AttestCalls, plan.VerifyCalls)
+	}
+	if strings.Join(plan.MissingIntents, ",") != "missing" {
+		t.Errorf("missing intents: got %v", plan.MissingIntents)
+	}
+	if len(plan.Unresolved) != 1 {
+		t.Errorf("unresolved: got %v", plan.Unresolved)
+	}
+	if n := srv.Count("/attest") + srv.Count("/session"); n != 0 {
+		t.Errorf("planning made %d session or attest calls", n)
+	}
+}
+
+func TestLintPolicy(t *testing.T) {
+	srv := fakeJane(t)
+	policy := &models.Policy{
+		Name:       "lint",
+		Jane:       srv.URL,
+		Collection: models.PolicyCollection{Names: []string{"web01"}},
+		Attestations: []models.AttestItem{
+			{Intent: "sys info", Endpoint: "tarzan", Rules: []models.Rule{{Name: "ok"}, {Name: "ok"}, {Name: "typo"}}},
+			{Intent: "nope", Endpoint: "mowgli"},
+		},
+	}
+
+	report := LintPolicy(context.Background(), policy)
+	var got []string
+	for _, i := range report.Issues {
+		got = append(got, i.Severity+" "+i.Field)
+	}
+	want := []string{
+		"warning attestations[0].rules[1]",
+		"warning attestations[1].rules",
+		"error attestations[0].rules[2].name",
+		"error attestations[1].intent",
+		"error attestations[1].endpoint",
+	}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+	if !report.HasErrors() {
+		t.Error("report has errors")
+	}
+}
+
+// update rewrites the cassettes in testdata from a run against the fake JANE
+var update = flag.Bool("update", false, "rewrite the cassettes in testdata")
+
+func TestRecordAndReplay(t *testing.T) {
+	srv := fakeJane(t)
+	srv.ClaimDelay(2)
+	policy := &models.Policy{
+		Name:       "recorded",
+		Jane:       srv.URL,
+		Collection: models.PolicyCollection{Tags: []string{"prod"}},
+		Attestations: []models.AttestItem{
+			{Intent: "sys info", Endpoint: "tarzan", Rules: []models.Rule{{Name: "ok"}, {Name: "bad", Parameter: map[string]interface{}{"api_token": "s3cr3t"}}}},
+			{Intent: "tpm quote", Endpoint: "tarzan", Rules: []models.Rule{{Name: "bad", Decision: models.DecisionAdvisory}}},
+		},
+	}
+
+	cassette := &jane.Cassette{}
+	recorded, _, err := ExecutePolicy(jane.WithRecorder(context.Background(), cassette), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cassette.SetPolicy(policy)
+	cassette.Verdict = Verdict(recorded, nil)
+	path := filepath.Join(t.TempDir(), "run.json")
+	if *update {
+		path = filepath.Join("testdata", "recorded.json")
+	}
+	if err := cassette.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "s3cr3t") {
+		t.Error("the cassette holds a secret")
+	}
+
+	// nothing may reach the network while replaying
+	srv.Close()
+	loaded, err := jane.LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, _, err := ExecutePolicy(jane.WithReplay(context.Background(), loaded), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := statuses(replayed), statuses(recorded); got != want {
+		t.Errorf("replayed %s\nrecorded %s", got, want)
+	}
+}
+
+// TestReplayFixtures replays every cassette in testdata and compares the verdict with the recorded one
+func TestReplayFixtures(t *testing.T) {
+	paths, _ := filepath.Glob(filepath.Join("testdata", "*.json"))
+	for _, path := range paths {
+		cassette, err := jane.LoadCassette(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var policy models.Policy
+		if err := json.Unmarshal(cassette.Policy, &policy); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		results, _, err := ExecutePolicy(jane.WithReplay(context.Background(), cassette), &policy)
+		if v := Verdict(results, err); v != cassette.Verdict {
+			t.Errorf("%s: verdict %s, recorded %s (%v) %s", path, v, cassette.Verdict, err, statuses(results))
+		}
+	}
+}
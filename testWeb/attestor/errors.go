@@ -0,0 +1,45 @@
+package attestor
+
+import (
+	"context"
+	"errors"
+
+	"janeauto/jane"
+	"janeauto/models"
+)
+
+// resultError classifies an error of a JANE call for AttestationResult.Error
+func resultError(err error) *models.ResultError {
+	re := &models.ResultError{Kind: models.ErrorKindUnreachable, Message: err.Error()}
+	var apiErr *jane.APIError
+	if errors.As(err, &apiErr) {
+		re.Kind = models.ErrorKindJane
+		re.Endpoint, re.Status, re.Code = apiErr.Endpoint, apiErr.Status, apiErr.Code
+	}
+	switch {
+	case errors.Is(err, jane.ErrCircuitOpen):
+		re.Kind = models.ErrorKindCircuitOpen
+	case errors.Is(err, context.Canceled):
+		re.Kind = models.ErrorKindCancelled
+	case errors.Is(err, jane.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		re.Kind = models.ErrorKindTimeout
+	case errors.Is(err, jane.ErrNotFound):
+		re.Kind = models.ErrorKindNotFound
+	}
+	return re
+}
+
+// hitBreaker reports whether any JANE call of the results was refused by the circuit breaker
+func hitBreaker(results []models.AttestationResult) bool {
+	for _, r := range results {
+		if r.Error != nil && r.Error.Kind == models.ErrorKindCircuitOpen {
+			return true
+		}
+		for _, rr := range r.RuleResults {
+			if rr["error_kind"] == models.ErrorKindCircuitOpen {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package attestor
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"janeauto/config"
+	"janeauto/jane"
+)
+
+// Limits bounds how many elements are attested at the same time.
+// Global applies across every policy run in the process, PerJane to each JANE instance.
+// Zero means no limit.
+type Limits struct {
+	Global  int
+	PerJane int
+}
+
+// semaphore is a counting semaphore; a nil semaphore never blocks
+type semaphore chan struct{}
+
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return make(semaphore, n)
+}
+
+func (s semaphore) acquire(ctx context.Context) error {
+	if s == nil {
+		return ctx.Err()
+	}
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s semaphore) release() {
+	if s != nil {
+		<-s
+	}
+}
+
+var (
+	limitsMu  sync.Mutex
+	limits    Limits
+	globalSem semaphore
+	janeSems  = make(map[string]semaphore)
+)
+
+// Configure sets the concurrency limits used by every ExecutePolicy call started afterwards
+func Configure(l Limits) {
+	limitsMu.Lock()
+	defer limitsMu.Unlock()
+	limits = l
+	globalSem = newSemaphore(l.Global)
+	janeSems = make(map[string]semaphore)
+}
+
+// claim waits per intent name with spaces removed, set by ConfigureClaimWaits
+var claimWaits map[string]jane.ClaimWait
+
+// ConfigureClaimWaits sets how long claims of the given intents are waited for.
+// Other intents, and zero fields, use the ClaimWait of the JANE client.
+func ConfigureClaimWaits(waits map[string]jane.ClaimWait) {
+	normalized := make(map[string]jane.ClaimWait, len(waits))
+	for intent, w := range waits {
+		normalized[strings.ReplaceAll(intent, " ", "")] = w
+	}
+	limitsMu.Lock()
+	defer limitsMu.Unlock()
+	claimWaits = normalized
+}
+
+// Setup applies cfg to the JANE clients, the claim waits and the concurrency limits,
+// so every program that runs policies talks to JANE the same way
+func Setup(cfg config.Configuration) {
+	opts := []jane.Option{
+		jane.WithTimeout(cfg.Jane.Timeout),
+		jane.WithUserAgent(cfg.Jane.UserAgent),
+		jane.WithRetry(jane.RetryPolicy{
+			Attempts:  cfg.Jane.Retry.Attempts,
+			BaseDelay: cfg.Jane.Retry.BaseDelay,
+			MaxDelay:  cfg.Jane.Retry.MaxDelay,
+			Mutating:  cfg.Jane.Retry.AttestAndVerify,
+		}),
+		jane.WithBreaker(cfg.Jane.Breaker.Threshold, cfg.Jane.Breaker.Cooldown),
+		jane.WithClaimWait(claimWait(cfg.Jane.ClaimWait)),
+	}
+	if cfg.Jane.Debug {
+		opts = append(opts, jane.WithLogger(log.New(os.Stdout, "", log.LstdFlags)))
+	}
+	jane.Configure(opts...)
+
+	intentWaits := make(map[string]jane.ClaimWait)
+	for intent, w := range cfg.Jane.ClaimWait.Intents {
+		intentWaits[intent] = claimWait(w)
+	}
+	ConfigureClaimWaits(intentWaits)
+
+	Configure(Limits{Global: cfg.Attestor.Concurrency, PerJane: cfg.Attestor.PerJane})
+}
+
+// claimWait converts the configured claim wait of JANE or of an intent
+func claimWait(c config.ClaimWaitConfig) jane.ClaimWait {
+	return jane.ClaimWait{Timeout: c.Timeout, Interval: c.Interval, MaxInterval: c.MaxInterval}
+}
+
+// claimWaitFor returns the claim wait configured for intent, zero if there is none
+func claimWaitFor(intent string) jane.ClaimWait {
+	limitsMu.Lock()
+	defer limitsMu.Unlock()
+	return claimWaits[strings.ReplaceAll(intent, " ", "")]
+}
+
+// semaphoresFor returns the global semaphore and the one shared by all runs against janeURL
+func semaphoresFor(janeURL string) (global, perJane semaphore) {
+	key := strings.TrimRight(janeURL, "/")
+
+	limitsMu.Lock()
+	defer limitsMu.Unlock()
+	s, ok := janeSems[key]
+	if !ok {
+		s = newSemaphore(limits.PerJane)
+		janeSems[key] = s
+	}
+	return globalSem, s
+}
+
+// forEachConcurrently calls fn for every index in [0, n) within the configured limits for janeURL.
+// Indexes whose turn comes after ctx is done are not run. It waits for all started calls to
+// return and reports ctx.Err() if the run was cut short.
+func forEachConcurrently(ctx context.Context, janeURL string, n int, fn func(ctx context.Context, i int)) error {
+	global, perJane := semaphoresFor(janeURL)
+
+	var wg sync.WaitGroup
+	var panicOnce sync.Once
+	var panicked interface{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// a panic in fn is passed on to the caller, which can recover from it unlike from this goroutine
+			defer func() {
+				if r := recover(); r != nil {
+					panicOnce.Do(func() { panicked = r })
+				}
+			}()
+
+			// takes the per-JANE slot first so a busy JANE does not hold global slots while it waits
+			if err := perJane.acquire(ctx); err != nil {
+				return
+			}
+			defer perJane.release()
+			if err := global.acquire(ctx); err != nil {
+				return
+			}
+			defer global.release()
+
+			fn(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+	if panicked != nil {
+		panic(panicked)
+	}
+	return ctx.Err()
+}
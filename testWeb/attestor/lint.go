@@ -0,0 +1,150 @@
+package attestor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"janeauto/jane"
+	"janeauto/models"
+)
+
+// How serious a lint finding is
+const (
+	LintError   = "error"   // the policy will not run as intended
+	LintWarning = "warning" // the policy runs but probably not as meant
+	LintInfo    = "info"    // a check could not be made
+)
+
+// LintIssue is one problem found in a policy
+type LintIssue struct {
+	Severity string `json:"severity"`
+	Field    string `json:"field"`
+	Message  string `json:"message"`
+}
+
+// LintReport lists everything LintPolicy found
+type LintReport struct {
+	Policy  string      `json:"policy"`
+	JaneURL string      `json:"jane_url"`
+	Issues  []LintIssue `json:"issues"`
+}
+
+// HasErrors reports whether any issue is an error
+func (r *LintReport) HasErrors() bool {
+	for _, i := range r.Issues {
+		if i.Severity == LintError {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *LintReport) add(severity, field, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, LintIssue{Severity: severity, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// LintPolicy checks a policy against the JANE it runs on: that its intents resolve, its rules
+// and endpoints exist and its collection selects elements. It also flags empty and duplicate rules.
+// Nothing is attested and no session is created.
+func LintPolicy(ctx context.Context, policy *models.Policy) *LintReport {
+	janeURL := JaneURL(policy)
+	client := jane.For(janeURL)
+	report := &LintReport{Policy: policy.Name, JaneURL: janeURL, Issues: []LintIssue{}}
+
+	lintRules(report, policy)
+
+	rules, err := client.ListRules(ctx)
+	if err != nil {
+		report.add(LintInfo, "attestations", "rule names not checked, JANE did not list its rules: %v", err)
+	}
+	knownRules := toSet(rules)
+	endpoints, err := client.ListEndpoints(ctx)
+	if err != nil {
+		report.add(LintInfo, "attestations", "endpoints not checked, JANE did not list its endpoints: %v", err)
+	}
+	knownEndpoints := toSet(endpoints)
+
+	intentChecked := make(map[string]error)
+	for i, a := range policy.Attestations {
+		field := fmt.Sprintf("attestations[%d]", i)
+
+		intent := strings.ReplaceAll(a.Intent, " ", "")
+		if intent != "" {
+			resolveErr, seen := intentChecked[intent]
+			if !seen {
+				_, resolveErr = client.GetIntentItemID(ctx, intent)
+				intentChecked[intent] = resolveErr
+			}
+			if resolveErr != nil {
+				report.add(LintError, field+".intent", "intent %q does not resolve on JANE: %v", a.Intent, resolveErr)
+			}
+		}
+
+		if knownEndpoints != nil && a.Endpoint != "" && !knownEndpoints[a.Endpoint] {
+			report.add(LintError, field+".endpoint", "endpoint %q is not known to JANE", a.Endpoint)
+		}
+
+		if knownRules != nil {
+			for j, r := range a.Rules {
+				if r.Name != "" && !knownRules[r.Name] {
+					report.add(LintError, fmt.Sprintf("%s.rules[%d].name", field, j), "rule %q does not exist on JANE", r.Name)
+				}
+			}
+		}
+	}
+
+	targets := resolveTargets(ctx, client, policy.Collection)
+	plan := buildPlan(policy, janeURL, targets, nil)
+	for _, sel := range plan.Unresolved {
+		report.add(LintWarning, "collection", "%s selects no element", sel)
+	}
+	if len(targets) == 0 {
+		report.add(LintError, "collection", "the collection does not select any element")
+	}
+
+	return report
+}
+
+// lintRules flags attestations without rules, empty rule names and rules listed twice
+func lintRules(report *LintReport, policy *models.Policy) {
+	attestations := make(map[string]int)
+	for i, a := range policy.Attestations {
+		field := fmt.Sprintf("attestations[%d]", i)
+
+		key := strings.ReplaceAll(a.Intent, " ", "") + "@" + a.Endpoint
+		if first, ok := attestations[key]; ok {
+			report.add(LintWarning, field, "repeats attestations[%d] (intent %q on endpoint %q)", first, a.Intent, a.Endpoint)
+		} else {
+			attestations[key] = i
+		}
+
+		if len(a.Rules) == 0 {
+			report.add(LintWarning, field+".rules", "no rules, the claim is collected but never verified")
+		}
+		seen := make(map[string]int)
+		for j, r := range a.Rules {
+			rf := fmt.Sprintf("%s.rules[%d]", field, j)
+			if strings.TrimSpace(r.Name) == "" {
+				report.add(LintError, rf+".name", "rule name is empty")
+				continue
+			}
+			if first, ok := seen[r.Name]; ok {
+				report.add(LintWarning, rf, "rule %q is already listed as rules[%d]", r.Name, first)
+				continue
+			}
+			seen[r.Name] = j
+		}
+	}
+}
+
+func toSet(names []string) map[string]bool {
+	if names == nil {
+		return nil
+	}
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[n] = true
+	}
+	return set
+}
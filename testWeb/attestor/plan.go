@@ -0,0 +1,108 @@
+package attestor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"janeauto/jane"
+	"janeauto/models"
+)
+
+// Plan is what ExecutePolicy would do for a policy, worked out without creating a session or attesting
+type Plan struct {
+	Policy  string `json:"policy"`
+	JaneURL string `json:"jane_url"`
+
+	Elements   []PlannedElement `json:"elements"`
+	Unresolved []string         `json:"unresolved,omitempty"` // collection entries that selected no element
+
+	Intents        []PlannedIntent `json:"intents"`
+	MissingIntents []string        `json:"missing_intents,omitempty"`
+
+	// Calls to JANE a run would make. VerifyCalls is an upper bound, fail-fast rules may cut it short.
+	AttestCalls int `json:"attest_calls"`
+	VerifyCalls int `json:"verify_calls"`
+}
+
+// PlannedElement is one element the policy's collection resolves to
+type PlannedElement struct {
+	ElementID   string   `json:"element_id"`
+	ElementName string   `json:"element_name,omitempty"`
+	SelectedBy  []string `json:"selected_by"`
+}
+
+// PlannedIntent is one attestation of the policy and the JANE intent it maps to
+type PlannedIntent struct {
+	Intent   string `json:"intent"`
+	Endpoint string `json:"endpoint"`
+	ItemID   string `json:"item_id,omitempty"`
+	Found    bool   `json:"found"`
+	Rules    int    `json:"rules"`
+}
+
+// PlanPolicy resolves a policy's collection and intents the same way ExecutePolicy does
+// and reports the outcome, without creating a session or attesting anything
+func PlanPolicy(ctx context.Context, policy *models.Policy) (*Plan, error) {
+	janeURL := JaneURL(policy)
+	client := jane.For(janeURL)
+
+	intentNameToItemID, err := resolveIntents(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list intents: %v", err)
+	}
+	targets := resolveTargets(ctx, client, policy.Collection)
+	return buildPlan(policy, janeURL, targets, intentNameToItemID), nil
+}
+
+func buildPlan(policy *models.Policy, janeURL string, targets []target, intentNameToItemID map[string]string) *Plan {
+	plan := &Plan{
+		Policy:   policy.Name,
+		JaneURL:  janeURL,
+		Elements: make([]PlannedElement, len(targets)),
+		Intents:  make([]PlannedIntent, len(policy.Attestations)),
+	}
+
+	selected := make(map[string]bool)
+	for i, t := range targets {
+		plan.Elements[i] = PlannedElement{ElementID: t.ElementID, ElementName: t.ElementName, SelectedBy: t.SelectedBy}
+		for _, via := range t.SelectedBy {
+			selected[via] = true
+		}
+	}
+	for _, via := range collectionSelectors(policy.Collection) {
+		if !selected[via] {
+			plan.Unresolved = append(plan.Unresolved, strings.TrimPrefix(via, "via "))
+		}
+	}
+
+	attestPerElement, verifyPerElement := 0, 0
+	for i, a := range policy.Attestations {
+		pid, ok := intentNameToItemID[strings.ReplaceAll(a.Intent, " ", "")]
+		plan.Intents[i] = PlannedIntent{Intent: a.Intent, Endpoint: a.Endpoint, ItemID: pid, Found: ok, Rules: len(a.Rules)}
+		if !ok {
+			plan.MissingIntents = append(plan.MissingIntents, a.Intent)
+			continue
+		}
+		attestPerElement++
+		verifyPerElement += len(a.Rules)
+	}
+	plan.AttestCalls = attestPerElement * len(targets)
+	plan.VerifyCalls = verifyPerElement * len(targets)
+	return plan
+}
+
+// collectionSelectors returns the SelectedBy reason each entry of a collection gives its elements
+func collectionSelectors(collection models.PolicyCollection) []string {
+	var out []string
+	for _, id := range collection.Items {
+		out = append(out, "via item "+id)
+	}
+	for _, name := range collection.Names {
+		out = append(out, "via name "+name)
+	}
+	for _, tag := range collection.Tags {
+		out = append(out, "via tag "+tag)
+	}
+	return out
+}
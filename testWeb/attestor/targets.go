@@ -0,0 +1,135 @@
+package attestor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"janeauto/jane"
+	"janeauto/models"
+)
+
+// target is one element selected by a policy collection, together with
+// the reasons it was selected ("via item ...", "via name ...", "via tag ...")
+type target struct {
+	ElementID   string
+	ElementName string
+	SelectedBy  []string
+}
+
+// targetSet collects targets in first-seen order and merges duplicates
+type targetSet struct {
+	order []string
+	byID  map[string]*target
+}
+
+func newTargetSet() *targetSet {
+	return &targetSet{byID: make(map[string]*target)}
+}
+
+func (s *targetSet) add(id, name, via string) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return
+	}
+	t, ok := s.byID[id]
+	if !ok {
+		t = &target{ElementID: id}
+		s.byID[id] = t
+		s.order = append(s.order, id)
+	}
+	if t.ElementName == "" {
+		t.ElementName = name
+	}
+	for _, v := range t.SelectedBy {
+		if v == via {
+			return
+		}
+	}
+	t.SelectedBy = append(t.SelectedBy, via)
+}
+
+func (s *targetSet) list() []target {
+	out := make([]target, 0, len(s.order))
+	for _, id := range s.order {
+		out = append(out, *s.byID[id])
+	}
+	return out
+}
+
+// resolveTargets expands the Items, Names and Tags of a collection into a single de-duplicated set of elements.
+// Lookup failures are logged and skipped, the same as the rest of the policy resolution.
+func resolveTargets(ctx context.Context, client *jane.Client, collection models.PolicyCollection) []target {
+	set := newTargetSet()
+
+	// direct item IDs have no name so we leave name empty
+	for _, id := range collection.Items {
+		set.add(id, "", "via item "+id)
+	}
+
+	for _, name := range collection.Names {
+		fmt.Printf("[DEBUG] Looking for elements with name: %s\n", name)
+		ids, err := client.GetElementsByName(ctx, name)
+		if err != nil {
+			fmt.Printf("[WARNING] Could not resolve name '%s': %v\n", name, err)
+			continue
+		}
+		for _, id := range ids {
+			set.add(id, name, "via name "+name)
+		}
+	}
+
+	for _, tt := range resolveTags(ctx, client, collection.Tags, collection.TagMatch) {
+		for _, via := range tt.SelectedBy {
+			set.add(tt.ElementID, "", via)
+		}
+	}
+
+	return set.list()
+}
+
+// resolveTags looks up the elements for each tag and combines them.
+// With models.TagMatchAnd only elements carrying every tag are kept; anything else means models.TagMatchOr.
+func resolveTags(ctx context.Context, client *jane.Client, tags []string, match string) []target {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	set := newTargetSet()
+	counts := make(map[string]int)
+	resolved := 0
+	for _, tag := range tags {
+		fmt.Printf("[DEBUG] Looking for elements with tag: %s\n", tag)
+		ids, err := client.GetElementsByTag(ctx, tag)
+		if err != nil {
+			fmt.Printf("[WARNING] Could not resolve tag '%s': %v\n", tag, err)
+			if strings.EqualFold(match, models.TagMatchAnd) {
+				// an element cannot be shown to carry a tag we could not look up
+				return nil
+			}
+			continue
+		}
+		resolved++
+		seen := make(map[string]bool)
+		for _, id := range ids {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			counts[id]++
+			set.add(id, "", "via tag "+tag)
+		}
+	}
+
+	if !strings.EqualFold(match, models.TagMatchAnd) {
+		return set.list()
+	}
+
+	var all []target
+	for _, t := range set.list() {
+		if counts[t.ElementID] == resolved {
+			all = append(all, t)
+		}
+	}
+	return all
+}
@@ -0,0 +1,76 @@
+package attestor
+
+import (
+	"context"
+
+	"janeauto/models"
+)
+
+// RunTrace holds hooks that are called while ExecutePolicy runs, in the spirit of net/http/httptrace.
+// Any hook may be nil. Hooks are called from the attestation workers, so they may run concurrently
+// and must not block for long.
+type RunTrace struct {
+	// ElementsResolved is called once the policy's collection has been resolved to element IDs
+	ElementsResolved func(elementIDs []string)
+	// SessionCreated is called with the ID of the JANE session the run uses
+	SessionCreated func(sessionID string)
+	// AttestationStarted is called before an element is attested for an intent
+	AttestationStarted func(elementID, intent string)
+	// ClaimFetched is called once the claim of an attestation has been retrieved
+	ClaimFetched func(elementID, intent, claimID string)
+	// RuleVerdict is called with the status of every rule run on a claim
+	RuleVerdict func(elementID, intent, rule, status string)
+	// ResultReady is called with each AttestationResult as soon as it is complete
+	ResultReady func(models.AttestationResult)
+}
+
+type runTraceKey struct{}
+
+// WithRunTrace returns a context that makes ExecutePolicy report its progress to trace
+func WithRunTrace(ctx context.Context, trace *RunTrace) context.Context {
+	return context.WithValue(ctx, runTraceKey{}, trace)
+}
+
+// traceFrom returns the trace attached to ctx, or an empty one
+func traceFrom(ctx context.Context) *RunTrace {
+	if t, ok := ctx.Value(runTraceKey{}).(*RunTrace); ok && t != nil {
+		return t
+	}
+	return &RunTrace{}
+}
+
+func (t *RunTrace) elementsResolved(ids []string) {
+	if t.ElementsResolved != nil {
+		t.ElementsResolved(ids)
+	}
+}
+
+func (t *RunTrace) sessionCreated(sid string) {
+	if t.SessionCreated != nil {
+		t.SessionCreated(sid)
+	}
+}
+
+func (t *RunTrace) attestationStarted(eid, intent string) {
+	if t.AttestationStarted != nil {
+		t.AttestationStarted(eid, intent)
+	}
+}
+
+func (t *RunTrace) claimFetched(eid, intent, claimID string) {
+	if t.ClaimFetched != nil {
+		t.ClaimFetched(eid, intent, claimID)
+	}
+}
+
+func (t *RunTrace) ruleVerdict(eid, intent, rule, status string) {
+	if t.RuleVerdict != nil {
+		t.RuleVerdict(eid, intent, rule, status)
+	}
+}
+
+func (t *RunTrace) resultReady(r models.AttestationResult) {
+	if t.ResultReady != nil {
+		t.ResultReady(r)
+	}
+}
@@ -0,0 +1,69 @@
+package attestor
+
+import (
+	"janeauto/config"
+	"janeauto/models"
+)
+
+// ResultCodesFor returns the result-code catalogue a policy runs with:
+// the configured catalogue with the policy's own entries laid on top
+func ResultCodesFor(policy *models.Policy) models.ResultCodes {
+	return config.ConfigData.Attestor.ResultCodes.Merge(policy.ResultCodes)
+}
+
+// ElementVerdicts rolls the results of a run up per element, in the order the elements first appear
+func ElementVerdicts(results []models.AttestationResult) []models.ElementVerdict {
+	var order []string
+	statuses := make(map[string][]string)
+	verdicts := make(map[string]*models.ElementVerdict)
+	for _, r := range results {
+		v, ok := verdicts[r.ElementID]
+		if !ok {
+			v = &models.ElementVerdict{ElementID: r.ElementID, ElementName: r.ElementName}
+			verdicts[r.ElementID] = v
+			order = append(order, r.ElementID)
+		}
+		v.Attestations++
+		v.Warnings += len(r.Warnings)
+		statuses[r.ElementID] = append(statuses[r.ElementID], r.EffectiveStatus())
+	}
+
+	out := make([]models.ElementVerdict, len(order))
+	for i, eid := range order {
+		v := verdicts[eid]
+		v.Status = models.Rollup(statuses[eid]...)
+		out[i] = *v
+	}
+	return out
+}
+
+// Verdict rolls the results of a run up into a single verdict.
+// A run that ended in err is an error and one without results a fail; otherwise the element
+// verdicts are rolled up, and a pass with warnings from advisory rules becomes a warn.
+func Verdict(results []models.AttestationResult, err error) string {
+	if err != nil {
+		return models.VerdictError
+	}
+	if len(results) == 0 {
+		return models.VerdictFail
+	}
+	elements := ElementVerdicts(results)
+	statuses := make([]string, len(elements))
+	for i, e := range elements {
+		statuses[i] = e.Status
+	}
+	verdict := models.Rollup(statuses...)
+	if verdict == models.VerdictPass && WarningCount(results) > 0 {
+		return models.VerdictWarn
+	}
+	return verdict
+}
+
+// WarningCount returns the number of warnings across all results
+func WarningCount(results []models.AttestationResult) int {
+	n := 0
+	for _, r := range results {
+		n += len(r.Warnings)
+	}
+	return n
+}
@@ -3,80 +3,157 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"path/filepath"
+	"os"
+	"os/user"
 
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"janeauto/attestor"
+	"janeauto/config"
+	"janeauto/db"
+	"janeauto/models"
+	"janeauto/policyfile"
+	"janeauto/provisioning"
 )
 
 func main() {
-	//MongoDB connection
-	uri := "mongodb://localhost:27017"
-	dbName := "testdb"
-	collectionName := "policies"
+	dir := flag.String("dir", "policies/examples", "directory to load policy files (.json, .yaml, .yml) from")
+	collection := flag.String("collection", "policies", "MongoDB collection to load the policies into")
+	author := flag.String("author", defaultAuthor(), "author recorded on the policy revisions written")
+	lint := flag.Bool("lint", false, "check each policy against its JANE and skip policies with lint errors")
+	// -mongo and -dbname, registered by config.ParseFlags, select the MongoDB server and database
+	config.ParseFlags()
 
-	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
-	if err != nil {
-		log.Fatal("Failed to connect to MongoDB:", err)
-	}
-	defer client.Disconnect(context.Background())
-
-	collection := client.Database(dbName).Collection(collectionName)
-
-	// Finds all JSON files in the examples folder. edit it for your folder
-	files, err := filepath.Glob("policies/examples/*.json")
-	if err != nil {
-		log.Fatal("Error finding JSON files:", err)
+	// loader [flags] import [-name N] [-o file] provisioning.yaml
+	if flag.Arg(0) == "import" {
+		if err := runImport(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	if len(files) == 0 {
-		fmt.Println("No policy files found in policies/examples/")
+	// loader [flags] replay [-v] cassette.json..., which works offline without a database configuration
+	if flag.Arg(0) == "replay" {
+		config.SetupOfflineConfiguration()
+		attestor.Setup(config.ConfigData)
+		if err := runReplay(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
 		return
 	}
 
-	for _, file := range files {
-		fmt.Printf("Processing %s...\n", file)
+	config.SetupConfiguration()
+	attestor.Setup(config.ConfigData)
+	db.UsePolicyCollection(*collection)
 
-		data, err := ioutil.ReadFile(file)
-		if err != nil {
-			log.Printf("Error reading %s: %v", file, err)
-			continue
+	// loader [flags] reconcile [-apply] [-watch]
+	if flag.Arg(0) == "reconcile" {
+		if err := runReconcile(*dir, *author, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
 		}
+		return
+	}
 
-		var policy map[string]interface{}
-		if err := json.Unmarshal(data, &policy); err != nil {
-			log.Printf("Error parsing %s: %v", file, err)
-			continue
+	// reads and checks every policy before touching the database
+	docs, loadErr := policyfile.LoadDir(*dir)
+	if loadErr != nil {
+		fmt.Println(loadErr)
+	}
+	if len(docs) == 0 {
+		fmt.Printf("No valid policy files found in %s\n", *dir)
+		if loadErr != nil {
+			os.Exit(1)
 		}
+		return
+	}
+
+	client := db.Connect(config.ConfigData.Database.Connection, config.ConfigData.Database.Name)
+	defer client.Disconnect(context.Background())
 
-		// Ensures the policy has a name field
-		name, ok := policy["name"].(string)
-		if !ok || name == "" {
-			log.Printf("Skipping %s: missing or invalid 'name' field", file)
+	failed := loadErr != nil
+	for _, doc := range docs {
+		name := doc.Policy.Name
+		fmt.Printf("Processing %s (%s:%d)...\n", name, doc.File, doc.Line)
+
+		if *lint && !lintPolicy(doc) {
+			log.Printf("Skipping %s: policy has lint errors", name)
+			failed = true
 			continue
 		}
+		doc.Policy.Source = models.SourceFile
 
-		// updates file if it exists, creates new if not
-		filter := map[string]interface{}{"name": name}
-		update := map[string]interface{}{"$set": policy}
-		opts := options.Update().SetUpsert(true)
-
-		result, err := collection.UpdateOne(context.Background(), filter, update, opts)
+		// replaces the policy if it exists, creates it if not
+		created, unchanged, err := db.SavePolicy(doc.Policy, *author, fmt.Sprintf("loaded from %s:%d", doc.File, doc.Line))
 		if err != nil {
 			log.Printf("Error upserting %s: %v", name, err)
+			failed = true
 			continue
 		}
 
-		if result.UpsertedID != nil {
-			fmt.Printf(" Inserted new policy: %s\n", name)
-		} else if result.ModifiedCount > 0 {
-			fmt.Printf(" Updated existing policy: %s\n", name)
+		if created {
+			fmt.Printf(" Inserted new policy: %s (revision %d)\n", name, doc.Policy.Revision)
+		} else if !unchanged {
+			fmt.Printf(" Updated existing policy: %s (revision %d)\n", name, doc.Policy.Revision)
 		} else {
 			fmt.Printf(" Policy unchanged: %s\n", name)
 		}
 	}
 
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// defaultAuthor is the login name of the user running the loader
+func defaultAuthor() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return "loader"
+}
+
+// lintPolicy prints the lint findings of a policy and reports whether it is free of errors
+func lintPolicy(doc policyfile.Document) bool {
+	report := attestor.LintPolicy(context.Background(), doc.Policy)
+	for _, issue := range report.Issues {
+		fmt.Printf(" %s:%d: %s: %s: %s\n", doc.File, doc.Line, issue.Severity, issue.Field, issue.Message)
+	}
+	return !report.HasErrors()
+}
+
+// runImport converts a provisioning file into policy JSON, written to stdout or to the -o file
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	name := fs.String("name", "", "policy name (default: derived from the element name)")
+	out := fs.String("o", "", "write the policy to this file instead of stdout")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: loader import [-name N] [-o file] provisioning.yaml")
+	}
+
+	data, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	policy, err := provisioning.ToPolicy(data, *name)
+	if err != nil {
+		return fmt.Errorf("%s: %v", fs.Arg(0), err)
+	}
+
+	encoded, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return err
+	}
+	encoded = append(encoded, '\n')
+	if *out == "" {
+		_, err = os.Stdout.Write(encoded)
+		return err
+	}
+	if err := ioutil.WriteFile(*out, encoded, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote policy %s to %s\n", policy.Name, *out)
+	return nil
 }
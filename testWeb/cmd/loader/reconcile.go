@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"janeauto/config"
+	"janeauto/db"
+	"janeauto/models"
+	"janeauto/policyfile"
+)
+
+// runReconcile makes the policy collection match the directory. Without -apply the changes
+// are only printed. With -watch it keeps running and reconciles again whenever a file changes.
+func runReconcile(dir, author string, args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	apply := fs.Bool("apply", false, "write the changes to MongoDB instead of only printing them")
+	watch := fs.Bool("watch", false, "keep running and reconcile whenever a policy file changes")
+	debounce := fs.Duration("debounce", 2*time.Second, "with -watch, wait this long after the last file change")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return fmt.Errorf("usage: loader [-dir D] [-author A] reconcile [-apply] [-watch] [-debounce 2s]")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client := db.Connect(config.ConfigData.Database.Connection, config.ConfigData.Database.Name)
+	defer client.Disconnect(context.Background())
+
+	err := reconcile(dir, author, *apply)
+	if !*watch {
+		return err
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	return watchDir(ctx, dir, *debounce, func() {
+		if err := reconcile(dir, author, *apply); err != nil {
+			fmt.Println(err)
+		}
+	})
+}
+
+// reconcile prints the changes between dir and the stored policies and, if apply is set, makes them
+func reconcile(dir, author string, apply bool) error {
+	docs, loadErr := policyfile.LoadDir(dir)
+	if loadErr != nil {
+		fmt.Println(loadErr)
+	}
+
+	current, err := db.GetAllPolicies()
+	if err != nil {
+		return fmt.Errorf("failed to list policies: %v", err)
+	}
+
+	changes := policyfile.Diff(docs, current)
+	printChanges(dir, changes)
+
+	if !apply {
+		return nil
+	}
+	// a file that does not load would look like a deleted policy
+	if loadErr != nil {
+		return fmt.Errorf("not applying: %s has files with errors", dir)
+	}
+
+	failed := 0
+	for _, c := range changes {
+		var err error
+		switch c.Action {
+		case policyfile.ActionCreate, policyfile.ActionUpdate:
+			c.Doc.Policy.Source = models.SourceFile
+			_, _, err = db.SavePolicy(c.Doc.Policy, author, fmt.Sprintf("reconciled from %s:%d", c.Doc.File, c.Doc.Line))
+		case policyfile.ActionDelete:
+			// only a policy that is still file-managed is deleted
+			err = db.DeletePolicyFrom(c.Name, models.SourceFile)
+		default:
+			continue
+		}
+		if err != nil {
+			fmt.Printf(" Error applying %s of %s: %v\n", c.Action, c.Name, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d change(s) failed", failed)
+	}
+	fmt.Println("Applied.")
+	return nil
+}
+
+func printChanges(dir string, changes []policyfile.Change) {
+	fmt.Printf("[%s] Reconciling %s\n", time.Now().Format(time.RFC3339), dir)
+	counts := make(map[string]int)
+	for _, c := range changes {
+		counts[c.Action]++
+		switch c.Action {
+		case policyfile.ActionCreate:
+			fmt.Printf(" + create %s (%s:%d)\n", c.Name, c.Doc.File, c.Doc.Line)
+		case policyfile.ActionUpdate:
+			fmt.Printf(" ~ update %s (%s:%d): %s\n", c.Name, c.Doc.File, c.Doc.Line, strings.Join(c.Fields, ", "))
+		case policyfile.ActionDelete:
+			fmt.Printf(" - delete %s\n", c.Name)
+		case policyfile.ActionKeep:
+			if c.Doc != nil {
+				fmt.Printf(" = keep   %s (%s:%d): %s\n", c.Name, c.Doc.File, c.Doc.Line, c.Reason)
+			} else {
+				fmt.Printf(" = keep   %s: %s\n", c.Name, c.Reason)
+			}
+		}
+	}
+	fmt.Printf(" %d to create, %d to update, %d to delete, %d protected\n",
+		counts[policyfile.ActionCreate], counts[policyfile.ActionUpdate], counts[policyfile.ActionDelete], counts[policyfile.ActionKeep])
+}
+
+// watchDir calls fn once the files below dir have stopped changing for the debounce time.
+// New subdirectories are watched as they appear. It returns when ctx is done.
+func watchDir(ctx context.Context, dir string, debounce time.Duration, fn func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %v", dir, err)
+	}
+	defer watcher.Close()
+
+	if err := addTree(watcher, dir); err != nil {
+		return err
+	}
+	fmt.Printf("Watching %s for changes\n", dir)
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					addTree(watcher, ev.Name)
+				}
+			}
+			if ev.Has(fsnotify.Chmod) {
+				continue
+			}
+			timer.Reset(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Printf("[WARNING] watching %s: %v\n", dir, err)
+		case <-timer.C:
+			fn()
+		}
+	}
+}
+
+// addTree watches dir and every directory below it
+func addTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if err := watcher.Add(path); err != nil {
+				return fmt.Errorf("failed to watch %s: %v", path, err)
+			}
+		}
+		return nil
+	})
+}
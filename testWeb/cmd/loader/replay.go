@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"janeauto/attestor"
+	"janeauto/jane"
+	"janeauto/models"
+)
+
+// runReplay runs the policy recorded in each cassette again, answering every JANE call from the
+// cassette, and fails when a verdict differs from the recorded one. No JANE or MongoDB is needed,
+// and config.yaml is optional; its result codes are used if it is there.
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	verbose := fs.Bool("v", false, "print the status of every element and intent")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: loader replay [-v] cassette.json...")
+	}
+
+	failed := false
+	for _, path := range fs.Args() {
+		ok, err := replayCassette(path, *verbose)
+		if err != nil {
+			fmt.Printf("%s: %v\n", path, err)
+		}
+		if err != nil || !ok {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// replayCassette replays one cassette and reports whether the verdict matches the recording
+func replayCassette(path string, verbose bool) (bool, error) {
+	cassette, err := jane.LoadCassette(path)
+	if err != nil {
+		return false, err
+	}
+	if len(cassette.Policy) == 0 {
+		return false, fmt.Errorf("the cassette does not hold a policy")
+	}
+	var policy models.Policy
+	if err := json.Unmarshal(cassette.Policy, &policy); err != nil {
+		return false, fmt.Errorf("cannot decode the recorded policy: %v", err)
+	}
+
+	ctx := jane.WithReplay(context.Background(), cassette)
+	results, _, runErr := attestor.ExecutePolicy(ctx, &policy)
+	verdict := attestor.Verdict(results, runErr)
+
+	if verbose {
+		for _, r := range results {
+			fmt.Printf(" %s %s: %s\n", r.ElementID, r.Intent, r.Status)
+		}
+	}
+	if runErr != nil {
+		fmt.Printf(" run error: %v\n", runErr)
+	}
+	if cassette.Verdict != "" && verdict != cassette.Verdict {
+		fmt.Printf("%s: policy %s: verdict %s, recorded %s\n", path, policy.Name, verdict, cassette.Verdict)
+		return false, nil
+	}
+	fmt.Printf("%s: policy %s: verdict %s (%d results)\n", path, policy.Name, verdict, len(results))
+	return true, nil
+}
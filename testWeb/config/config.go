@@ -0,0 +1,414 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v4"
+
+	"janeauto/models"
+)
+
+// SystemConfig holds general settings about this janeauto instance
+type SystemConfig struct {
+	Name string `yaml:"name"`
+}
+
+// DatabaseConfig holds the MongoDB connection settings
+type DatabaseConfig struct {
+	Connection string `yaml:"connection"`
+	Name       string `yaml:"name"`
+}
+
+// JaneConfig holds the settings of the default JANE instance.
+// Policies that do not name their own JANE fall back to URL.
+// Retry, Breaker and ClaimWait apply to every JANE instance, see jane.RetryPolicy, jane.WithBreaker and jane.ClaimWait.
+type JaneConfig struct {
+	URL       string          `yaml:"url"`
+	UIPort    int             `yaml:"uiPort"`
+	Timeout   time.Duration   `yaml:"timeout"`
+	UserAgent string          `yaml:"userAgent"`
+	Debug     bool            `yaml:"debug"`
+	Retry     RetryConfig     `yaml:"retry"`
+	Breaker   BreakerConfig   `yaml:"breaker"`
+	ClaimWait ClaimWaitConfig `yaml:"claimWait"`
+}
+
+// ClaimWaitConfig says how long claims are waited for and how often JANE is polled, see jane.ClaimWait.
+// Intents overrides it for slow intents such as TPM quotes, by intent name; zero fields keep the values above.
+type ClaimWaitConfig struct {
+	Timeout     time.Duration              `yaml:"timeout"`
+	Interval    time.Duration              `yaml:"interval"`
+	MaxInterval time.Duration              `yaml:"maxInterval"`
+	Intents     map[string]ClaimWaitConfig `yaml:"intents"`
+}
+
+// RetryConfig says how often failed JANE calls are tried. GETs and session creation are
+// always retried, /attest and /verify only with AttestAndVerify.
+type RetryConfig struct {
+	Attempts        int           `yaml:"attempts"`
+	BaseDelay       time.Duration `yaml:"baseDelay"`
+	MaxDelay        time.Duration `yaml:"maxDelay"`
+	AttestAndVerify bool          `yaml:"attestAndVerify"`
+}
+
+// BreakerConfig opens a JANE's circuit breaker after Threshold calls in a row failed; 0 turns it off.
+// Calls fail fast until Cooldown has passed.
+type BreakerConfig struct {
+	Threshold int           `yaml:"threshold"`
+	Cooldown  time.Duration `yaml:"cooldown"`
+}
+
+// RestConfig holds the settings of the janeauto web server
+type RestConfig struct {
+	Port     int    `yaml:"port"`
+	ListenOn string `yaml:"listenOn"`
+	UseHTTP  bool   `yaml:"usehttp"`
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+}
+
+// AttestorConfig bounds how many elements are attested at once.
+// Concurrency applies across all policy runs, PerJane to each JANE instance; 0 means unlimited.
+// ResultCodes is the catalogue of JANE verification result codes, which policies can override;
+// 0 is a pass and any other code not listed a fail.
+type AttestorConfig struct {
+	Concurrency int                `yaml:"concurrency"`
+	PerJane     int                `yaml:"perJane"`
+	ResultCodes models.ResultCodes `yaml:"resultCodes"`
+}
+
+// RunnerConfig sizes the background queue that executes policy runs.
+// Finished runs are served from memory for Retention and from the database afterwards.
+// When RecordDir is set the JANE traffic of every run is written there as a cassette, see jane.Cassette.
+type RunnerConfig struct {
+	Workers   int           `yaml:"workers"`
+	QueueSize int           `yaml:"queueSize"`
+	Retention time.Duration `yaml:"retention"`
+	RecordDir string        `yaml:"recordDir"`
+}
+
+// SchedulerConfig controls the scheduler that runs policies on their cron schedule.
+// Policies are reread from the database every ReloadInterval and whenever one is changed through the API.
+type SchedulerConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	ReloadInterval time.Duration `yaml:"reloadInterval"`
+}
+
+// Configuration is the typed form of config.yaml
+type Configuration struct {
+	System    SystemConfig    `yaml:"system"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Jane      JaneConfig      `yaml:"jane"`
+	Rest      RestConfig      `yaml:"rest"`
+	Attestor  AttestorConfig  `yaml:"attestor"`
+	Runner    RunnerConfig    `yaml:"runner"`
+	Scheduler SchedulerConfig `yaml:"scheduler"`
+}
+
+// ConfigData is the active configuration, filled in by SetupConfiguration
+var ConfigData Configuration
+
+// command line flags, registered by ParseFlags
+var (
+	configFile     *string
+	flagMongo      *string
+	flagDBName     *string
+	flagJaneURL    *string
+	flagPort       *int
+	flagListenOn   *string
+	flagSystemName *string
+)
+
+// Default returns the configuration used for any value that is not set
+// in the configuration file, the environment or on the command line
+func Default() Configuration {
+	return Configuration{
+		System: SystemConfig{
+			Name: "JaneAuto",
+		},
+		Jane: JaneConfig{
+			URL:       "http://127.0.0.1:8520",
+			UIPort:    8540,
+			Timeout:   30 * time.Second,
+			UserAgent: "janeauto",
+			Retry: RetryConfig{
+				Attempts:  3,
+				BaseDelay: 200 * time.Millisecond,
+				MaxDelay:  5 * time.Second,
+			},
+			Breaker: BreakerConfig{
+				Threshold: 5,
+				Cooldown:  30 * time.Second,
+			},
+			ClaimWait: ClaimWaitConfig{
+				Timeout:     30 * time.Second,
+				Interval:    100 * time.Millisecond,
+				MaxInterval: 2 * time.Second,
+			},
+		},
+		Rest: RestConfig{
+			Port:     8080,
+			ListenOn: "0.0.0.0",
+			UseHTTP:  true,
+		},
+		Attestor: AttestorConfig{
+			Concurrency: 32,
+			PerJane:     8,
+			ResultCodes: models.ResultCodes{
+				0:    {Status: models.StatusPass, Explanation: "rule passed", Severity: models.SeverityInfo},
+				9098: {Status: models.StatusError, Explanation: "JANE could not evaluate the rule", Severity: models.SeverityMedium},
+			},
+		},
+		Runner: RunnerConfig{
+			Workers:   4,
+			QueueSize: 100,
+			Retention: 10 * time.Minute,
+		},
+		Scheduler: SchedulerConfig{
+			Enabled:        true,
+			ReloadInterval: time.Minute,
+		},
+	}
+}
+
+// ParseFlags registers and parses the command line flags.
+// Flags that are given on the command line override the configuration file and the environment.
+func ParseFlags() {
+	configFile = flag.String("config", "config.yaml", "path to the configuration file")
+	flagMongo = flag.String("mongo", "", "MongoDB connection URI (overrides database.connection)")
+	flagDBName = flag.String("dbname", "", "MongoDB database name (overrides database.name)")
+	flagJaneURL = flag.String("jane", "", "JANE API URL (overrides jane.url)")
+	flagPort = flag.Int("port", 0, "port for the web server (overrides rest.port)")
+	flagListenOn = flag.String("listen", "", "address for the web server to listen on (overrides rest.listenOn)")
+	flagSystemName = flag.String("name", "", "name of this instance (overrides system.name)")
+	flag.Parse()
+}
+
+// SetupConfiguration loads the configuration file, applies the environment and
+// command line overrides and validates the result. It exits if the configuration is unusable.
+func SetupConfiguration() {
+	path := "config.yaml"
+	if configFile != nil {
+		path = *configFile
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	applyFlags(cfg)
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration in %s:\n%v", path, err)
+	}
+
+	ConfigData = *cfg
+}
+
+// SetupOfflineConfiguration is SetupConfiguration for commands that need neither MongoDB nor
+// a live JANE, e.g. replaying a cassette. A missing configuration file means the defaults,
+// and the result is not validated, so an incomplete database section does not stop them.
+func SetupOfflineConfiguration() {
+	path := "config.yaml"
+	if configFile != nil {
+		path = *configFile
+	}
+
+	cfg := Default()
+	if _, err := os.Stat(path); err == nil {
+		loaded, err := Load(path)
+		if err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
+		cfg = *loaded
+	} else if err := applyEnv(&cfg, os.LookupEnv); err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	applyFlags(&cfg)
+	ConfigData = cfg
+}
+
+// Load reads the configuration file at path on top of the defaults and applies the environment overrides.
+// It does not validate the result.
+func Load(path string) (*Configuration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	if err := applyEnv(cfg, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Parse decodes a configuration document on top of the defaults.
+// Unknown keys are rejected so that typos do not go unnoticed.
+func Parse(data []byte) (*Configuration, error) {
+	cfg := Default()
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// environment variables that override the configuration file
+const (
+	EnvSystemName   = "JANEAUTO_SYSTEM_NAME"
+	EnvDBConnection = "JANEAUTO_DATABASE_CONNECTION"
+	EnvDBName       = "JANEAUTO_DATABASE_NAME"
+	EnvJaneURL      = "JANEAUTO_JANE_URL"
+	EnvJaneUIPort   = "JANEAUTO_JANE_UIPORT"
+	EnvJaneTimeout  = "JANEAUTO_JANE_TIMEOUT"
+	EnvJaneDebug    = "JANEAUTO_JANE_DEBUG"
+
+	EnvJaneRetryAttempts        = "JANEAUTO_JANE_RETRY_ATTEMPTS"
+	EnvJaneRetryBaseDelay       = "JANEAUTO_JANE_RETRY_BASEDELAY"
+	EnvJaneRetryMaxDelay        = "JANEAUTO_JANE_RETRY_MAXDELAY"
+	EnvJaneRetryAttestAndVerify = "JANEAUTO_JANE_RETRY_ATTESTANDVERIFY"
+	EnvJaneBreakerThreshold     = "JANEAUTO_JANE_BREAKER_THRESHOLD"
+	EnvJaneBreakerCooldown      = "JANEAUTO_JANE_BREAKER_COOLDOWN"
+	EnvJaneClaimWaitTimeout     = "JANEAUTO_JANE_CLAIMWAIT_TIMEOUT"
+	EnvJaneClaimWaitInterval    = "JANEAUTO_JANE_CLAIMWAIT_INTERVAL"
+	EnvJaneClaimWaitMaxInterval = "JANEAUTO_JANE_CLAIMWAIT_MAXINTERVAL"
+
+	EnvRestPort     = "JANEAUTO_REST_PORT"
+	EnvRestListenOn = "JANEAUTO_REST_LISTENON"
+	EnvRestUseHTTP  = "JANEAUTO_REST_USEHTTP"
+	EnvRestCertFile = "JANEAUTO_REST_CERTFILE"
+	EnvRestKeyFile  = "JANEAUTO_REST_KEYFILE"
+
+	EnvAttestorConcurrency = "JANEAUTO_ATTESTOR_CONCURRENCY"
+	EnvAttestorPerJane     = "JANEAUTO_ATTESTOR_PERJANE"
+
+	EnvRunnerWorkers   = "JANEAUTO_RUNNER_WORKERS"
+	EnvRunnerQueueSize = "JANEAUTO_RUNNER_QUEUESIZE"
+	EnvRunnerRecordDir = "JANEAUTO_RUNNER_RECORDDIR"
+
+	EnvSchedulerEnabled        = "JANEAUTO_SCHEDULER_ENABLED"
+	EnvSchedulerReloadInterval = "JANEAUTO_SCHEDULER_RELOADINTERVAL"
+)
+
+func applyEnv(cfg *Configuration, lookup func(string) (string, bool)) error {
+	strs := map[string]*string{
+		EnvSystemName:   &cfg.System.Name,
+		EnvDBConnection: &cfg.Database.Connection,
+		EnvDBName:       &cfg.Database.Name,
+		EnvJaneURL:      &cfg.Jane.URL,
+		EnvRestListenOn: &cfg.Rest.ListenOn,
+		EnvRestCertFile: &cfg.Rest.CertFile,
+		EnvRestKeyFile:  &cfg.Rest.KeyFile,
+
+		EnvRunnerRecordDir: &cfg.Runner.RecordDir,
+	}
+	for name, field := range strs {
+		if v, ok := lookup(name); ok {
+			*field = v
+		}
+	}
+
+	ints := map[string]*int{
+		EnvJaneUIPort: &cfg.Jane.UIPort,
+		EnvRestPort:   &cfg.Rest.Port,
+
+		EnvJaneRetryAttempts:    &cfg.Jane.Retry.Attempts,
+		EnvJaneBreakerThreshold: &cfg.Jane.Breaker.Threshold,
+
+		EnvAttestorConcurrency: &cfg.Attestor.Concurrency,
+		EnvAttestorPerJane:     &cfg.Attestor.PerJane,
+
+		EnvRunnerWorkers:   &cfg.Runner.Workers,
+		EnvRunnerQueueSize: &cfg.Runner.QueueSize,
+	}
+	for name, field := range ints {
+		if v, ok := lookup(name); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a number", name, v)
+			}
+			*field = n
+		}
+	}
+
+	bools := map[string]*bool{
+		EnvJaneDebug:   &cfg.Jane.Debug,
+		EnvRestUseHTTP: &cfg.Rest.UseHTTP,
+
+		EnvJaneRetryAttestAndVerify: &cfg.Jane.Retry.AttestAndVerify,
+
+		EnvSchedulerEnabled: &cfg.Scheduler.Enabled,
+	}
+	for name, field := range bools {
+		if v, ok := lookup(name); ok {
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a boolean", name, v)
+			}
+			*field = b
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		EnvJaneTimeout: &cfg.Jane.Timeout,
+
+		EnvJaneRetryBaseDelay:  &cfg.Jane.Retry.BaseDelay,
+		EnvJaneRetryMaxDelay:   &cfg.Jane.Retry.MaxDelay,
+		EnvJaneBreakerCooldown: &cfg.Jane.Breaker.Cooldown,
+
+		EnvJaneClaimWaitTimeout:     &cfg.Jane.ClaimWait.Timeout,
+		EnvJaneClaimWaitInterval:    &cfg.Jane.ClaimWait.Interval,
+		EnvJaneClaimWaitMaxInterval: &cfg.Jane.ClaimWait.MaxInterval,
+
+		EnvSchedulerReloadInterval: &cfg.Scheduler.ReloadInterval,
+	}
+	for name, field := range durations {
+		if v, ok := lookup(name); ok {
+			d, err := time.ParseDuration(strings.TrimSpace(v))
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a duration", name, v)
+			}
+			*field = d
+		}
+	}
+	return nil
+}
+
+func applyFlags(cfg *Configuration) {
+	if flagMongo != nil && *flagMongo != "" {
+		cfg.Database.Connection = *flagMongo
+	}
+	if flagDBName != nil && *flagDBName != "" {
+		cfg.Database.Name = *flagDBName
+	}
+	if flagJaneURL != nil && *flagJaneURL != "" {
+		cfg.Jane.URL = *flagJaneURL
+	}
+	if flagPort != nil && *flagPort != 0 {
+		cfg.Rest.Port = *flagPort
+	}
+	if flagListenOn != nil && *flagListenOn != "" {
+		cfg.Rest.ListenOn = *flagListenOn
+	}
+	if flagSystemName != nil && *flagSystemName != "" {
+		cfg.System.Name = *flagSystemName
+	}
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Validate checks every field of the configuration and returns all problems found,
+// one per line, prefixed with the config key they belong to
+func (c *Configuration) Validate() error {
+	var errs []error
+
+	if strings.TrimSpace(c.System.Name) == "" {
+		errs = append(errs, errors.New("system.name: must not be empty"))
+	}
+
+	if err := validateURL(c.Database.Connection, "mongodb", "mongodb+srv"); err != nil {
+		errs = append(errs, fmt.Errorf("database.connection: %v", err))
+	}
+	if strings.TrimSpace(c.Database.Name) == "" {
+		errs = append(errs, errors.New("database.name: must not be empty"))
+	} else if strings.ContainsAny(c.Database.Name, `/\. "$`) {
+		errs = append(errs, fmt.Errorf("database.name: %q contains characters MongoDB does not allow", c.Database.Name))
+	}
+
+	if err := validateURL(c.Jane.URL, "http", "https"); err != nil {
+		errs = append(errs, fmt.Errorf("jane.url: %v", err))
+	}
+	if err := validatePort(c.Jane.UIPort); err != nil {
+		errs = append(errs, fmt.Errorf("jane.uiPort: %v", err))
+	}
+	if c.Jane.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("jane.timeout: %v must be positive", c.Jane.Timeout))
+	}
+
+	if err := validatePort(c.Rest.Port); err != nil {
+		errs = append(errs, fmt.Errorf("rest.port: %v", err))
+	}
+	if c.Rest.ListenOn != "" && net.ParseIP(c.Rest.ListenOn) == nil && !isHostname(c.Rest.ListenOn) {
+		errs = append(errs, fmt.Errorf("rest.listenOn: %q is not an IP address or hostname", c.Rest.ListenOn))
+	}
+	if !c.Rest.UseHTTP {
+		if c.Rest.CertFile == "" {
+			errs = append(errs, errors.New("rest.certFile: required when rest.usehttp is false"))
+		}
+		if c.Rest.KeyFile == "" {
+			errs = append(errs, errors.New("rest.keyFile: required when rest.usehttp is false"))
+		}
+	}
+
+	if c.Attestor.Concurrency < 0 {
+		errs = append(errs, fmt.Errorf("attestor.concurrency: %d must not be negative", c.Attestor.Concurrency))
+	}
+	if c.Attestor.PerJane < 0 {
+		errs = append(errs, fmt.Errorf("attestor.perJane: %d must not be negative", c.Attestor.PerJane))
+	}
+
+	for code, rc := range c.Attestor.ResultCodes {
+		if err := rc.Check(); err != nil {
+			errs = append(errs, fmt.Errorf("attestor.resultCodes.%d: %v", code, err))
+		}
+	}
+
+	if c.Runner.Workers < 1 {
+		errs = append(errs, fmt.Errorf("runner.workers: %d must be at least 1", c.Runner.Workers))
+	}
+	if c.Runner.QueueSize < 1 {
+		errs = append(errs, fmt.Errorf("runner.queueSize: %d must be at least 1", c.Runner.QueueSize))
+	}
+	if c.Runner.Retention < 0 {
+		errs = append(errs, fmt.Errorf("runner.retention: %v must not be negative", c.Runner.Retention))
+	}
+
+	if c.Scheduler.ReloadInterval < time.Second {
+		errs = append(errs, fmt.Errorf("scheduler.reloadInterval: %v must be at least 1s", c.Scheduler.ReloadInterval))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateURL checks that raw is an absolute URL with a host and one of the given schemes
+func validateURL(raw string, schemes ...string) error {
+	if strings.TrimSpace(raw) == "" {
+		return errors.New("must not be empty")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid URL: %v", raw, err)
+	}
+	schemeOK := false
+	for _, s := range schemes {
+		if u.Scheme == s {
+			schemeOK = true
+			break
+		}
+	}
+	if !schemeOK {
+		return fmt.Errorf("%q must use one of the schemes %s", raw, strings.Join(schemes, ", "))
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q has no host", raw)
+	}
+	return nil
+}
+
+func validatePort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("%d is outside the range 1-65535", port)
+	}
+	return nil
+}
+
+func isHostname(s string) bool {
+	if len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
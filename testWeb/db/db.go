@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -14,9 +15,10 @@ import (
 )
 
 var client *mongo.Client
+var database *mongo.Database
 
-// establishes connection to mongodb
-func Connect(uri string) *mongo.Client {
+// establishes connection to mongodb and selects the database to use
+func Connect(uri, dbName string) *mongo.Client {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -31,6 +33,14 @@ func Connect(uri string) *mongo.Client {
 
 	fmt.Println("Connected to MongoDB!")
 	client = c
+	database = c.Database(dbName)
+
+	if err := ensurePolicyIndexes(ctx); err != nil {
+		log.Println("Failed to create policy indexes:", err)
+	}
+	if err := ensureRunIndexes(ctx); err != nil {
+		log.Println("Failed to create run indexes:", err)
+	}
 	return client
 }
 
@@ -40,10 +50,13 @@ func GetPolicyByName(name string) (*models.Policy, error) {
 	defer cancel()
 
 	var policy models.Policy
-	err := client.Database("testdb").Collection("policies").
+	err := database.Collection(policiesCollection).
 		FindOne(ctx, bson.M{"name": name}).
 		Decode(&policy)
 
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -55,7 +68,7 @@ func GetAllPolicies() ([]models.Policy, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	cursor, err := client.Database("testdb").Collection("policies").
+	cursor, err := database.Collection(policiesCollection).
 		Find(ctx, bson.M{})
 	if err != nil {
 		return nil, err
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"janeauto/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// the collections of the policies and their revisions, see UsePolicyCollection
+var (
+	policiesCollection         = "policies"
+	revisionsCollection        = "policy_revisions"
+	revisionCountersCollection = "policy_revision_counters"
+)
+
+// UsePolicyCollection keeps policies in the named collection instead of "policies". Their
+// revisions go to collections named after it, so policies in different collections do not
+// share a history. Call it before Connect.
+func UsePolicyCollection(name string) {
+	if name == "" || name == policiesCollection {
+		return
+	}
+	policiesCollection = name
+	revisionsCollection = name + "_revisions"
+	revisionCountersCollection = name + "_revision_counters"
+}
+
+var (
+	// ErrNotFound is returned when the requested document does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned when a document with the same unique key already exists
+	ErrDuplicate = errors.New("already exists")
+)
+
+// creates the unique index on policy names and the revision index
+func ensurePolicyIndexes(ctx context.Context) error {
+	_, err := database.Collection(policiesCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	return ensureRevisionIndexes(ctx)
+}
+
+// CreatePolicy stores a new policy as its next revision, by author with a change note.
+// It returns ErrDuplicate if the name is taken.
+func CreatePolicy(policy *models.Policy, author, note string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := recordRevision(ctx, policy, author, note); err != nil {
+		return err
+	}
+
+	_, err := database.Collection(policiesCollection).InsertOne(ctx, policy)
+	if err != nil {
+		dropRevision(ctx, policy)
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// ReplacePolicy overwrites the policy called name and records it as a new revision. It returns
+// ErrNotFound if there is no such policy and ErrDuplicate if the policy is renamed to a name that is taken.
+// A renamed policy continues the revisions of its new name; the old name keeps its history.
+func ReplacePolicy(name string, policy *models.Policy, author, note string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := recordRevision(ctx, policy, author, note); err != nil {
+		return err
+	}
+
+	res, err := database.Collection(policiesCollection).ReplaceOne(ctx, bson.M{"name": name}, policy)
+	if err == nil && res.MatchedCount == 0 {
+		err = ErrNotFound
+	}
+	if err != nil {
+		dropRevision(ctx, policy)
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// recordRevision numbers the policy's next revision and stores it. The revision is written
+// before the policy itself, so a policy is never saved without the revision it claims.
+func recordRevision(ctx context.Context, policy *models.Policy, author, note string) error {
+	n, err := nextRevision(ctx, policy.Name)
+	if err != nil {
+		return err
+	}
+	policy.Revision = n
+	return insertRevision(ctx, policy, author, note)
+}
+
+// SavePolicy creates or replaces the policy with the same name. A new revision is only recorded
+// when the content or the source changed; unchanged reports that nothing was written.
+func SavePolicy(policy *models.Policy, author, note string) (created, unchanged bool, err error) {
+	current, err := GetPolicyByName(policy.Name)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return true, false, CreatePolicy(policy, author, note)
+	case err != nil:
+		return false, false, err
+	}
+	if len(models.ChangedFields(policy, current)) == 0 && policy.Source == current.Source {
+		policy.Revision = current.Revision
+		return false, true, nil
+	}
+	return false, false, ReplacePolicy(policy.Name, policy, author, note)
+}
+
+// DeletePolicy removes the policy called name. It returns ErrNotFound if there is no such policy.
+func DeletePolicy(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := database.Collection(policiesCollection).DeleteOne(ctx, bson.M{"name": name})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeletePolicyFrom removes the policy called name only if it is managed by source, so a policy
+// that was taken over elsewhere in the meantime is left alone. It returns ErrNotFound if there
+// is no such policy from that source.
+func DeletePolicyFrom(name, source string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := database.Collection(policiesCollection).DeleteOne(ctx, bson.M{"name": name, "source": source})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"janeauto/models"
+)
+
+// creates the index that keeps revision numbers unique per policy
+func ensureRevisionIndexes(ctx context.Context) error {
+	_, err := database.Collection(revisionsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "policy", Value: 1}, {Key: "number", Value: -1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// nextRevision takes the number the next revision of the named policy gets. Numbers come from
+// a per-policy counter that is incremented atomically, so concurrent saves never share one.
+func nextRevision(ctx context.Context, name string) (int, error) {
+	n, err := incrementRevision(ctx, name)
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return n, err
+	}
+
+	// no counter yet, start it at the newest revision already stored, e.g. from before counters
+	last, err := lastRevision(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	_, err = database.Collection(revisionCountersCollection).UpdateOne(ctx,
+		bson.M{"_id": name},
+		bson.M{"$max": bson.M{"last": last}},
+		options.Update().SetUpsert(true))
+	// a concurrent save may have created the counter first, which is just as good
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return 0, err
+	}
+	return incrementRevision(ctx, name)
+}
+
+// incrementRevision bumps the counter of the named policy and returns its new value
+func incrementRevision(ctx context.Context, name string) (int, error) {
+	var counter struct {
+		Last int `bson:"last"`
+	}
+	err := database.Collection(revisionCountersCollection).
+		FindOneAndUpdate(ctx, bson.M{"_id": name}, bson.M{"$inc": bson.M{"last": 1}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).
+		Decode(&counter)
+	return counter.Last, err
+}
+
+// lastRevision returns the number of the newest stored revision of the named policy, 0 if there is none
+func lastRevision(ctx context.Context, name string) (int, error) {
+	var last models.Revision
+	err := database.Collection(revisionsCollection).
+		FindOne(ctx, bson.M{"policy": name}, options.FindOne().
+			SetSort(bson.D{{Key: "number", Value: -1}}).
+			SetProjection(bson.M{"number": 1})).
+		Decode(&last)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return last.Number, nil
+}
+
+// insertRevision stores the policy as saved under its revision number
+func insertRevision(ctx context.Context, policy *models.Policy, author, note string) error {
+	snapshot := *policy
+	_, err := database.Collection(revisionsCollection).InsertOne(ctx, models.Revision{
+		ID:       primitive.NewObjectID().Hex(),
+		Policy:   policy.Name,
+		Number:   policy.Revision,
+		Author:   author,
+		Time:     time.Now().UTC(),
+		Note:     note,
+		Document: &snapshot,
+	})
+	return err
+}
+
+// dropRevision removes a revision whose policy write failed. It is best effort, a leftover
+// revision only adds an entry to the history that never went live.
+func dropRevision(ctx context.Context, policy *models.Policy) {
+	_, err := database.Collection(revisionsCollection).DeleteOne(ctx, bson.M{"policy": policy.Name, "number": policy.Revision})
+	if err != nil {
+		fmt.Printf("[WARNING] Could not remove revision %d of policy %s: %v\n", policy.Revision, policy.Name, err)
+	}
+}
+
+// ListRevisions returns the revisions of the named policy, newest first, without their documents
+func ListRevisions(name string) ([]models.Revision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := database.Collection(revisionsCollection).Find(ctx, bson.M{"policy": name}, options.Find().
+		SetSort(bson.D{{Key: "number", Value: -1}}).
+		SetProjection(bson.M{"document": 0}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	revisions := []models.Revision{}
+	if err = cursor.All(ctx, &revisions); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// GetRevision retrieves one revision of the named policy, including the policy as it was saved
+func GetRevision(name string, number int) (*models.Revision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var rev models.Revision
+	err := database.Collection(revisionsCollection).
+		FindOne(ctx, bson.M{"policy": name, "number": number}).
+		Decode(&rev)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
@@ -0,0 +1,197 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"janeauto/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	runsCollection    = "runs"
+	resultsCollection = "results"
+)
+
+// creates the indexes used to look up runs and results
+func ensureRunIndexes(ctx context.Context) error {
+	_, err := database.Collection(runsCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "policy", Value: 1}, {Key: "queued_at", Value: -1}}},
+		{Keys: bson.D{{Key: "queued_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection(resultsCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "run_id", Value: 1}}},
+		{Keys: bson.D{{Key: "element_id", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "policy", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "time", Value: -1}}},
+	})
+	return err
+}
+
+// NewRunID returns a fresh, time-ordered run ID
+func NewRunID() string {
+	return primitive.NewObjectID().Hex()
+}
+
+// InsertRun stores a run that has just been queued or started. The run gets a new ID if it has none.
+func InsertRun(run *models.Run) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if run.ID == "" {
+		run.ID = NewRunID()
+	}
+	_, err := database.Collection(runsCollection).InsertOne(ctx, run)
+	return err
+}
+
+// UpdateRun stores the current state of a run, e.g. after its status changed
+func UpdateRun(run *models.Run) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Collection(runsCollection).ReplaceOne(ctx, bson.M{"_id": run.ID}, run,
+		options.Replace().SetUpsert(true))
+	return err
+}
+
+// FinishRun stores the final state of a run together with its results.
+// Each result is linked to the run and stamped with the run's policy.
+func FinishRun(run *models.Run, results []models.AttestationResult) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	run.ResultCount = len(results)
+	if len(results) > 0 {
+		docs := make([]interface{}, len(results))
+		for i := range results {
+			results[i].RunID = run.ID
+			results[i].Policy = run.PolicyName
+			if results[i].Time.IsZero() {
+				results[i].Time = run.FinishedAt
+			}
+			docs[i] = results[i]
+		}
+		if _, err := database.Collection(resultsCollection).InsertMany(ctx, docs); err != nil {
+			return err
+		}
+	}
+
+	_, err := database.Collection(runsCollection).ReplaceOne(ctx, bson.M{"_id": run.ID}, run,
+		options.Replace().SetUpsert(true))
+	return err
+}
+
+// GetRun retrieves a single run by its ID
+func GetRun(id string) (*models.Run, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var run models.Run
+	err := database.Collection(runsCollection).
+		FindOne(ctx, bson.M{"_id": id}).
+		Decode(&run)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// GetRunResults retrieves the results of a run in the order they were produced
+func GetRunResults(runID string) ([]models.AttestationResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := database.Collection(resultsCollection).
+		Find(ctx, bson.M{"run_id": runID}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	results := []models.AttestationResult{}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// RunFilter narrows down ListRuns. Empty fields match everything.
+type RunFilter struct {
+	Policy      string
+	Status      string
+	TriggeredBy string
+	Since       time.Time
+	Until       time.Time
+}
+
+// ListRuns returns one page of runs, newest first, together with the total number of matching runs.
+// Pages start at 1. The policy snapshots are left out to keep the listing small.
+func ListRuns(filter RunFilter, page, pageSize int) ([]models.Run, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+
+	query := bson.M{}
+	if filter.Policy != "" {
+		query["policy"] = filter.Policy
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if filter.TriggeredBy != "" {
+		query["triggered_by"] = filter.TriggeredBy
+	}
+	queued := bson.M{}
+	if !filter.Since.IsZero() {
+		queued["$gte"] = filter.Since
+	}
+	if !filter.Until.IsZero() {
+		queued["$lt"] = filter.Until
+	}
+	if len(queued) > 0 {
+		query["queued_at"] = queued
+	}
+
+	coll := database.Collection(runsCollection)
+	total, err := coll.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "queued_at", Value: -1}}).
+		SetSkip(int64((page - 1) * pageSize)).
+		SetLimit(int64(pageSize)).
+		SetProjection(bson.M{"policy_snapshot": 0})
+
+	cursor, err := coll.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	runs := []models.Run{}
+	if err = cursor.All(ctx, &runs); err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
@@ -3,7 +3,9 @@ module janeauto
 go 1.24.5
 
 require (
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/labstack/echo/v4 v4.13.4
+	github.com/robfig/cron/v3 v3.0.1
 	go.mongodb.org/mongo-driver v1.17.4
 	go.yaml.in/yaml/v4 v4.0.0-rc.4
 )
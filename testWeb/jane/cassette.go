@@ -0,0 +1,258 @@
+package jane
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cassette holds the JANE traffic of one policy run. A run recorded with WithRecorder can be
+// replayed with WithReplay, which answers every request from the cassette without any network.
+//
+// Only methods, paths, bodies and status codes are kept, never headers. Values of secret
+// looking keys in bodies and query strings are replaced by Redacted. Requests are matched by
+// method, path and body, so the hosts of the recorded and the replaying JANE do not matter.
+type Cassette struct {
+	RunID        string          `json:"run_id,omitempty"`
+	Policy       json.RawMessage `json:"policy,omitempty"`  // the policy that ran, see SetPolicy
+	Verdict      string          `json:"verdict,omitempty"` // the verdict of the recorded run, set by the caller
+	Recorded     time.Time       `json:"recorded"`
+	Interactions []Interaction   `json:"interactions"`
+
+	mu     sync.Mutex
+	served map[string]int // replay position per request key
+}
+
+// Interaction is one request and the response JANE gave. JSON bodies are stored as JSON, anything else as text.
+type Interaction struct {
+	Method       string          `json:"method"`
+	Path         string          `json:"path"`
+	RequestBody  json.RawMessage `json:"request_body,omitempty"`
+	RequestText  string          `json:"request_text,omitempty"`
+	Status       int             `json:"status"`
+	ResponseBody json.RawMessage `json:"response_body,omitempty"`
+	ResponseText string          `json:"response_text,omitempty"`
+}
+
+// Redacted replaces secrets in cassettes
+const Redacted = "REDACTED"
+
+// secretKeys are the parts of key names whose values are redacted, compared case-insensitively
+var secretKeys = []string{"password", "passwd", "secret", "token", "apikey", "api_key", "api-key", "authorization", "credential", "private_key", "privatekey", "cookie"}
+
+// LoadCassette reads a cassette written by Save
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s is not a cassette: %v", path, err)
+	}
+	// Save indents the bodies, requests are matched on their compact form
+	for i, in := range c.Interactions {
+		if len(in.RequestBody) > 0 {
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, in.RequestBody); err != nil {
+				return nil, fmt.Errorf("%s: interaction %d: %v", path, i, err)
+			}
+			c.Interactions[i].RequestBody = buf.Bytes()
+		}
+	}
+	return &c, nil
+}
+
+// SetPolicy stores the policy that ran, with its secrets redacted like the traffic
+func (c *Cassette) SetPolicy(policy interface{}) error {
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	c.Policy, _ = encodeBody(data)
+	return nil
+}
+
+// Save writes the cassette as indented JSON
+func (c *Cassette) Save(path string) error {
+	c.mu.Lock()
+	data, err := json.MarshalIndent(c, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+type cassetteKey int
+
+const (
+	recordKey cassetteKey = iota
+	replayKey
+)
+
+// WithRecorder returns a context under which every JANE call is also appended to c
+func WithRecorder(ctx context.Context, c *Cassette) context.Context {
+	if c.Recorded.IsZero() {
+		c.Recorded = time.Now().UTC()
+	}
+	return context.WithValue(ctx, recordKey, c)
+}
+
+// WithReplay returns a context under which JANE calls are answered from c instead of the network
+func WithReplay(ctx context.Context, c *Cassette) context.Context {
+	return context.WithValue(ctx, replayKey, c)
+}
+
+// record sends req and appends the exchange to the cassette
+func (c *Cassette) record(client *http.Client, req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			reqBody, _ = io.ReadAll(body)
+			body.Close()
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	in := Interaction{Method: req.Method, Path: redactPath(req.URL), Status: resp.StatusCode}
+	in.RequestBody, in.RequestText = encodeBody(reqBody)
+	in.ResponseBody, in.ResponseText = encodeBody(respBody)
+
+	c.mu.Lock()
+	c.Interactions = append(c.Interactions, in)
+	c.mu.Unlock()
+	return resp, nil
+}
+
+// replay answers req with the next recorded response to the same request.
+// Once those are used up the last one is repeated, e.g. for a claim that is polled more often.
+func (c *Cassette) replay(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	var reqBody []byte
+	if req.Body != nil {
+		reqBody, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+	}
+	body, text := encodeBody(reqBody)
+	key := interactionKey(req.Method, redactPath(req.URL), body, text)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.served == nil {
+		c.served = make(map[string]int)
+	}
+	var matches []*Interaction
+	for i := range c.Interactions {
+		in := &c.Interactions[i]
+		if interactionKey(in.Method, in.Path, in.RequestBody, in.RequestText) == key {
+			matches = append(matches, in)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("replay: no recorded response for %s %s", req.Method, req.URL.Path)
+	}
+	n := c.served[key]
+	if n >= len(matches) {
+		n = len(matches) - 1
+	}
+	c.served[key]++
+	in := matches[n]
+
+	respBody := []byte(in.ResponseText)
+	if len(in.ResponseBody) > 0 {
+		respBody = in.ResponseBody
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+		StatusCode:    in.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}, nil
+}
+
+func interactionKey(method, path string, body json.RawMessage, text string) string {
+	return method + " " + path + " " + string(body) + text
+}
+
+// encodeBody redacts a JSON body and returns it in canonical form, or returns any other body as text
+func encodeBody(data []byte) (json.RawMessage, string) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, ""
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, string(data)
+	}
+	out, _ := json.Marshal(redact(v))
+	return out, ""
+}
+
+// redact replaces the values of secret looking keys, at any depth
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if isSecret(k) {
+				v[k] = Redacted
+				continue
+			}
+			v[k] = redact(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = redact(e)
+		}
+	}
+	return v
+}
+
+// redactPath returns the path and query of u with secret query parameters redacted
+func redactPath(u *url.URL) string {
+	path := u.EscapedPath()
+	if u.RawQuery == "" {
+		return path
+	}
+	q := u.Query()
+	for k := range q {
+		if isSecret(k) {
+			q[k] = []string{Redacted}
+		}
+	}
+	return path + "?" + q.Encode()
+}
+
+func isSecret(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range secretKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
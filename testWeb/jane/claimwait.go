@@ -0,0 +1,156 @@
+package jane
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ClaimWait says how long WaitForClaim waits for a claim to appear and how often it looks.
+// The wait between polls starts at Interval and doubles up to MaxInterval.
+// Zero fields take the value of the client's ClaimWait, see WithClaimWait.
+type ClaimWait struct {
+	Timeout     time.Duration // give up after this long; 0 waits as long as the context allows
+	Interval    time.Duration
+	MaxInterval time.Duration
+}
+
+// DefaultClaimWait is the ClaimWait of a Client built without WithClaimWait
+var DefaultClaimWait = ClaimWait{Timeout: 30 * time.Second, Interval: 100 * time.Millisecond, MaxInterval: 2 * time.Second}
+
+// WithClaimWait sets how long the client waits for claims unless told otherwise per call
+func WithClaimWait(w ClaimWait) Option {
+	return func(c *Client) { c.ClaimWait = w }
+}
+
+// or fills the zero fields of w from def
+func (w ClaimWait) or(def ClaimWait) ClaimWait {
+	if w.Timeout == 0 {
+		w.Timeout = def.Timeout
+	}
+	if w.Interval == 0 {
+		w.Interval = def.Interval
+	}
+	if w.MaxInterval == 0 {
+		w.MaxInterval = def.MaxInterval
+	}
+	return w
+}
+
+// claimPaths are the path prefixes JANE versions serve claims under
+var claimPaths = []string{"/claim/", "/claims/"}
+
+// GetClaim waits for a claim with the client's ClaimWait, see WaitForClaim
+func (c *Client) GetClaim(ctx context.Context, claimID string) (map[string]interface{}, error) {
+	claim, _, err := c.WaitForClaim(ctx, claimID, ClaimWait{})
+	return claim, err
+}
+
+// WaitForClaim polls JANE until the claim appears and returns it with the time it took.
+// JANE answers 404 while it is still collecting the claim. Until it is known under which
+// prefix this JANE serves claims, every round tries all of them; the one that answers is
+// remembered for the following claims. A prefix answering a status that means there is no
+// such route, e.g. 405, is dropped; any other error status ends the wait with an APIError.
+// Running out of w.Timeout fails with ErrTimeout, cancelling ctx with ctx.Err().
+func (c *Client) WaitForClaim(ctx context.Context, claimID string, w ClaimWait) (map[string]interface{}, time.Duration, error) {
+	w = w.or(c.ClaimWait)
+	start := time.Now()
+	waitCtx := ctx
+	if w.Timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, w.Timeout)
+		defer cancel()
+	}
+	timedOut := func() (map[string]interface{}, time.Duration, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, time.Since(start), err
+		}
+		return nil, time.Since(start), fmt.Errorf("claim %s did not appear within %v: %w", claimID, w.Timeout, ErrTimeout)
+	}
+
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultClaimWait.Interval
+	}
+	rejected := make(map[string]bool)
+	for poll := 1; ; poll++ {
+		prefixes := c.claimPrefixes(rejected)
+		if len(prefixes) == 0 {
+			return nil, time.Since(start), fmt.Errorf("claim %s: %w, JANE serves claims under none of %s", claimID, ErrNotFound, strings.Join(claimPaths, ", "))
+		}
+		for _, prefix := range prefixes {
+			status, body, err := c.get(waitCtx, prefix+url.PathEscape(claimID))
+			if err != nil {
+				if waitCtx.Err() != nil {
+					return timedOut()
+				}
+				return nil, time.Since(start), fmt.Errorf("failed to get claim: %w", err)
+			}
+			c.debugf("[DEBUG] Claim %s poll %d at %s: status %d", claimID, poll, prefix, status)
+
+			switch status {
+			case http.StatusOK:
+				var claim map[string]interface{}
+				if err := json.Unmarshal(body, &claim); err != nil {
+					return nil, time.Since(start), fmt.Errorf("failed to decode claim: %v", err)
+				}
+				c.rememberClaimPrefix(prefix)
+				return claim, time.Since(start), nil
+			case http.StatusNotFound:
+			case http.StatusBadRequest, http.StatusMethodNotAllowed, http.StatusGone, http.StatusNotImplemented:
+				c.debugf("[DEBUG] %s%s does not serve claims (status %d)", c.BaseURL, prefix, status)
+				rejected[prefix] = true
+				c.forgetClaimPrefix(prefix)
+			default:
+				// e.g. JANE failing with 5xx beyond the retries, which says nothing about the prefix
+				return nil, time.Since(start), statusError(prefix, status, body)
+			}
+		}
+
+		select {
+		case <-waitCtx.Done():
+			return timedOut()
+		case <-time.After(interval):
+		}
+		if interval *= 2; w.MaxInterval > 0 && interval > w.MaxInterval {
+			interval = w.MaxInterval
+		}
+	}
+}
+
+// claimPrefixes returns the prefix this JANE is known to serve claims under, or else every one not rejected
+func (c *Client) claimPrefixes(rejected map[string]bool) []string {
+	c.claimMu.Lock()
+	defer c.claimMu.Unlock()
+	if c.claimPrefix != "" && !rejected[c.claimPrefix] {
+		return []string{c.claimPrefix}
+	}
+	var out []string
+	for _, p := range claimPaths {
+		if !rejected[p] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (c *Client) rememberClaimPrefix(prefix string) {
+	c.claimMu.Lock()
+	defer c.claimMu.Unlock()
+	if c.claimPrefix != prefix {
+		c.debugf("[DEBUG] %s serves claims under %s", c.BaseURL, prefix)
+		c.claimPrefix = prefix
+	}
+}
+
+func (c *Client) forgetClaimPrefix(prefix string) {
+	c.claimMu.Lock()
+	defer c.claimMu.Unlock()
+	if c.claimPrefix == prefix {
+		c.claimPrefix = ""
+	}
+}
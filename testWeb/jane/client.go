@@ -0,0 +1,144 @@
+package jane
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// default settings of a Client
+const (
+	DefaultTimeout   = 30 * time.Second
+	DefaultUserAgent = "janeauto"
+)
+
+// sharedTransport is used by every Client that is not given its own transport,
+// so connections to the same JANE are pooled across policies and requests
+var sharedTransport http.RoundTripper = func() http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = 32
+	return t
+}()
+
+// Client talks to a single JANE instance.
+// A Client is safe for concurrent use and should be built once per JANE instance, see For.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	UserAgent  string
+	Logger     *log.Logger
+	Retry      RetryPolicy
+	ClaimWait  ClaimWait
+
+	breaker *breaker // shared by every call to this JANE, nil when turned off
+
+	claimMu     sync.Mutex
+	claimPrefix string // where this JANE serves claims, once a claim was found
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithTimeout limits how long a single HTTP request to JANE may take
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) { c.HTTPClient.Timeout = d }
+}
+
+// WithTransport replaces the shared transport, e.g. to record traffic or to talk to a test server
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) { c.HTTPClient.Transport = rt }
+}
+
+// WithUserAgent sets the User-Agent header sent with every request
+func WithUserAgent(ua string) Option {
+	return func(c *Client) { c.UserAgent = ua }
+}
+
+// WithLogger sends the client's debug output to l. Without a logger the client is silent.
+func WithLogger(l *log.Logger) Option {
+	return func(c *Client) { c.Logger = l }
+}
+
+// NewClient builds a Client for the JANE API at baseURL
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{
+			Timeout:   DefaultTimeout,
+			Transport: sharedTransport,
+		},
+		UserAgent: DefaultUserAgent,
+		Retry:     DefaultRetry,
+		ClaimWait: DefaultClaimWait,
+		breaker:   &breaker{threshold: DefaultBreakerThreshold, cooldown: DefaultBreakerCooldown},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// clients built by For, one per JANE base URL
+var (
+	clientsMu      sync.Mutex
+	clients        = make(map[string]*Client)
+	defaultOptions []Option
+)
+
+// Configure sets the options used for every Client built by For from now on.
+// It drops the clients built so far so that they pick up the new options.
+func Configure(opts ...Option) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	defaultOptions = opts
+	clients = make(map[string]*Client)
+}
+
+// For returns the shared Client for the JANE instance at baseURL, building it on first use
+func For(baseURL string) *Client {
+	key := strings.TrimRight(baseURL, "/")
+
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if c, ok := clients[key]; ok {
+		return c
+	}
+	c := NewClient(key, defaultOptions...)
+	clients[key] = c
+	return c
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+// do sends req, or answers it from the cassette of a replaying context, see WithReplay and WithRecorder
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	c.debugf("[DEBUG] %s %s", req.Method, req.URL)
+	ctx := req.Context()
+	if cas, ok := ctx.Value(replayKey).(*Cassette); ok {
+		return cas.replay(req)
+	}
+	if cas, ok := ctx.Value(recordKey).(*Cassette); ok {
+		return cas.record(c.HTTPClient, req)
+	}
+	return c.HTTPClient.Do(req)
+}
+
+func (c *Client) debugf(format string, args ...interface{}) {
+	if c.Logger != nil {
+		c.Logger.Printf(format, args...)
+	}
+}
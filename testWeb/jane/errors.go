@@ -0,0 +1,75 @@
+package jane
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrNotFound is matched by errors.Is when JANE does not know the element, intent, claim or result asked for
+	ErrNotFound = errors.New("not found on JANE")
+	// ErrTimeout is matched by errors.Is when JANE did not answer in time
+	ErrTimeout = errors.New("JANE did not answer in time")
+)
+
+// APIError is an error JANE answered with, either as an HTTP status or as an "error" in the body
+type APIError struct {
+	Endpoint string // path of the request, e.g. "/attest"
+	Status   int    // HTTP status of the answer
+	Message  string // JANE's error text, or the body if it had none
+	Code     int    // JANE result code, if the answer carried one
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	if e.Status >= 200 && e.Status < 300 {
+		fmt.Fprintf(&b, "JANE error on %s", e.Endpoint)
+	} else {
+		fmt.Fprintf(&b, "JANE returned status %d on %s", e.Status, e.Endpoint)
+	}
+	if e.Message != "" {
+		b.WriteString(": " + e.Message)
+	}
+	if e.Code != 0 {
+		fmt.Fprintf(&b, " (result code %d)", e.Code)
+	}
+	return b.String()
+}
+
+// Is lets errors.Is match a 404 as ErrNotFound and a 408 or 504 as ErrTimeout
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Status == http.StatusNotFound
+	case ErrTimeout:
+		return e.Status == http.StatusRequestTimeout || e.Status == http.StatusGatewayTimeout
+	}
+	return false
+}
+
+// statusError builds the APIError for an answer with an unexpected status, taking the text from
+// an "error" field and the code from a "result" field if there are any
+func statusError(endpoint string, status int, body []byte) *APIError {
+	var res struct {
+		Error  string `json:"error"`
+		Result int    `json:"result"`
+	}
+	msg := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &res) == nil && res.Error != "" {
+		msg = res.Error
+	}
+	return &APIError{Endpoint: endpoint, Status: status, Message: msg, Code: res.Result}
+}
+
+// transportError marks timeouts of a failed request so that errors.Is matches ErrTimeout
+func transportError(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
@@ -2,226 +2,333 @@ package jane
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
-	"time"
+	"net/url"
 )
 
 // GetElementsByName retrieves element uuids by their name
-func GetElementsByName(janeURL, name string) ([]string, error) {
-	url := janeURL + "/elements/name/" + name
-	fmt.Printf("[DEBUG] getting elements from URL: %s\n", url)
+func (c *Client) GetElementsByName(ctx context.Context, name string) ([]string, error) {
+	return c.getElements(ctx, "/elements/name/"+url.PathEscape(name), "name", name)
+}
+
+// GetElementsByTag retrieves the uuids of all elements carrying the given tag
+func (c *Client) GetElementsByTag(ctx context.Context, tag string) ([]string, error) {
+	return c.getElements(ctx, "/elements/tag/"+url.PathEscape(tag), "tag", tag)
+}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get(url)
+func (c *Client) getElements(ctx context.Context, path, kind, value string) ([]string, error) {
+	status, body, err := c.get(ctx, path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get elements: %v", err)
+		return nil, fmt.Errorf("failed to get elements: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		body, _ := ioutil.ReadAll(resp.Body)
-		return nil, fmt.Errorf("JANE returned status %d: %s", resp.StatusCode, string(body))
+	if status != http.StatusOK {
+		return nil, statusError(path, status, body)
 	}
 
 	var result struct {
-		Elements	[]string	`json:"elements"`
-		Length		int		`json:"length"`
+		Elements []string `json:"elements"`
+		Length   int      `json:"length"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := json.Unmarshal(body, &result); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %v", err)
 	}
 
-	fmt.Printf("[DEBUG] Found %d elements for name '%s': %v\n", result.Length, name, result.Elements)
+	c.debugf("[DEBUG] Found %d elements for %s '%s': %v", result.Length, kind, value, result.Elements)
 	return result.Elements, nil
 }
 
-// GetIntentItemID returns the itemid for a given intent name
-func GetIntentItemID(janeURL, intentName string) (string, error) {
-	// tries by name
-	url := fmt.Sprintf("%s/intents/name/%s", janeURL, intentName)
-	fmt.Printf("[DEBUG-INTENT] Trying endpoint: %s\n", url)
+// ListIntents returns the names of all intents known to JANE
+func (c *Client) ListIntents(ctx context.Context) ([]string, error) {
+	status, body, err := c.get(ctx, "/intents")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch intents: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, statusError("/intents", status, body)
+	}
 
-	resp, err := http.Get(url)
+	var result struct {
+		Intents []string `json:"intents"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode intents: %v", err)
+	}
+	return result.Intents, nil
+}
+
+// ListRules returns the names of the rules JANE can verify claims with
+func (c *Client) ListRules(ctx context.Context) ([]string, error) {
+	return c.listNames(ctx, "/rules", "rules")
+}
+
+// ListEndpoints returns the names of the endpoints JANE can attest through, e.g. "tarzan"
+func (c *Client) ListEndpoints(ctx context.Context) ([]string, error) {
+	return c.listNames(ctx, "/endpoints", "endpoints")
+}
+
+// listNames fetches a list like {"rules": [...]}. Entries may be plain names or objects with a "name".
+func (c *Client) listNames(ctx context.Context, path, key string) ([]string, error) {
+	status, body, err := c.get(ctx, path)
 	if err != nil {
-		return "", fmt.Errorf("HTTP request failed: %v", err)
+		return nil, fmt.Errorf("failed to fetch %s: %w", key, err)
+	}
+	if status != http.StatusOK {
+		return nil, statusError(path, status, body)
 	}
-	defer resp.Body.Close()
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	fmt.Printf("[DEBUG-INTENT] Response status &d, body: %s\n", resp.StatusCode, string(body))
+	var result map[string][]json.RawMessage
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", key, err)
+	}
+	names := make([]string, 0, len(result[key]))
+	for _, raw := range result[key] {
+		var name string
+		if err := json.Unmarshal(raw, &name); err == nil {
+			names = append(names, name)
+			continue
+		}
+		var obj struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %v", key, err)
+		}
+		names = append(names, obj.Name)
+	}
+	return names, nil
+}
 
-	if resp.StatusCode == 200 {
+// GetIntentItemID returns the itemid for a given intent name
+func (c *Client) GetIntentItemID(ctx context.Context, intentName string) (string, error) {
+	// tries by name
+	status, body, err := c.get(ctx, "/intents/name/"+url.PathEscape(intentName))
+	if err != nil {
+		return "", fmt.Errorf("HTTP request failed: %w", err)
+	}
+	c.debugf("[DEBUG-INTENT] Response status %d, body: %s", status, string(body))
+
+	if status == http.StatusOK {
 		var result struct {
-			Intents	[]string	`json:"intents"`
-			Length	int		`json:"length"`
+			Intents []string `json:"intents"`
+			Length  int      `json:"length"`
 		}
 		if err := json.Unmarshal(body, &result); err != nil {
 			return "", fmt.Errorf("Failed to decode response: %v", err)
 		}
-		if result.Length > 0 {
+		if result.Length > 0 && len(result.Intents) > 0 {
 			return result.Intents[0], nil
 		}
 	}
 
 	// Fallback which treats intentName as ItemID
-	testURL := fmt.Sprintf("%s/intent/%s", janeURL, intentName)
-	fmt.Printf("[DEBUG-INTENT] Trying direct ItemID fetch: %s\n", testURL)
-
-	testResp, err := http.Get(testURL)
+	status, _, err = c.get(ctx, "/intent/"+url.PathEscape(intentName))
 	if err != nil {
-		return "", fmt.Errorf("direct fetch failed: %v", err)
+		return "", fmt.Errorf("direct fetch failed: %w", err)
 	}
-	defer testResp.Body.Close()
-
-	if testResp.StatusCode == 200 {
-		fmt.Printf("[DEBUG-INTENT] intentName '%s' is the ItemID\n", intentName)
+	if status == http.StatusOK {
+		c.debugf("[DEBUG-INTENT] intentName '%s' is the ItemID", intentName)
 		return intentName, nil
 	}
 
-	return "", fmt.Errorf("intent '%s' not found by name or as ItemID", intentName)
+	return "", fmt.Errorf("intent '%s': %w by name or as ItemID", intentName, ErrNotFound)
 }
 
-// RunVerification executes a rule on a claim and returns the result ID and pass or fail
-func RunVerification(janeURL, claimID, ruleName, sessionID string) (string, int, bool, error) {
+// RunVerification executes a rule on a claim and returns the result ID and pass or fail.
+// params are sent as the rule's "parameters"; nil sends an empty object.
+func (c *Client) RunVerification(ctx context.Context, claimID, ruleName, sessionID string, params map[string]interface{}) (string, int, bool, error) {
 	verifyData := map[string]interface{}{
-		"cid":		claimID,
-		"rule":		ruleName,
-		"sid":		sessionID,
-		"parameters":	map[string]interface{}{},
+		"cid":        claimID,
+		"rule":       ruleName,
+		"sid":        sessionID,
+		"parameters": parameters(params),
 	}
 
-	body, _ := json.Marshal(verifyData)
-	fmt.Printf("[DEBUG] Sending verification request:\n%s\n", string(body))
-
-	resp, err := http.Post(fmt.Sprintf("%s/verify", janeURL), "application/json", bytes.NewBuffer(body))
+	status, rawBody, err := c.post(ctx, "/verify", verifyData)
 	if err != nil {
-		return "", 0, false, fmt.Errorf("verify call failed: %v", err)
+		return "", 0, false, fmt.Errorf("verify call failed: %w", err)
+	}
+	// a failed call may still carry a JSON body, it must not be read as a result
+	if status < http.StatusOK || status >= http.StatusMultipleChoices {
+		return "", 0, false, statusError("/verify", status, rawBody)
 	}
-	defer resp.Body.Close()
-
-	rawBody, _ := ioutil.ReadAll(resp.Body)
-	fmt.Printf("[DEBUG] Verify response status: %d:\n%s\n", resp.StatusCode, string(rawBody))
 
 	var result struct {
-		ItemID	string	`json:"itemid"`
-		Result	int	`json:"result"`
-		Error	string	`json:"error"`
+		ItemID string `json:"itemid"`
+		Result int    `json:"result"`
+		Error  string `json:"error"`
 	}
 	if err := json.Unmarshal(rawBody, &result); err != nil {
 		return "", 0, false, fmt.Errorf("failed to parse verify response: %v", err)
 	}
 
 	if result.Error != "" {
-		return "", 0, false, fmt.Errorf("JANE verification error: %s", result.Error)
+		return "", 0, false, &APIError{Endpoint: "/verify", Status: status, Message: result.Error, Code: result.Result}
 	}
 
 	passed := (result.Result == 0)
 	return result.ItemID, result.Result, passed, nil
 }
 
-// RunAttestation sends an attestation request and returns the claimID
-func RunAttestation(janeURL, elementID, pid, endpoint, sessionID string) (string, error) {
+// RunAttestation sends an attestation request and returns the claimID.
+// params are sent as the attestation's "parameters"; nil sends an empty object.
+func (c *Client) RunAttestation(ctx context.Context, elementID, pid, endpoint, sessionID string, params map[string]interface{}) (string, error) {
 	attestData := map[string]interface{}{
-		"eid":		elementID,
-		"pid":		pid,
-		"epn":		endpoint,
-		"sid":		sessionID,
-		"parameters":	map[string]interface{}{},
+		"eid":        elementID,
+		"pid":        pid,
+		"epn":        endpoint,
+		"sid":        sessionID,
+		"parameters": parameters(params),
 	}
 
-	body, _ := json.Marshal(attestData)
-	fmt.Printf("[DEBUG] Sending attestation request:\n%s\n", string(body))
-
-	resp, err := http.Post(fmt.Sprintf("%s/attest", janeURL), "application/json", bytes.NewBuffer(body))
+	status, rawBody, err := c.post(ctx, "/attest", attestData)
 	if err != nil {
-		return "", fmt.Errorf("attest call failed: %v", err)
+		return "", fmt.Errorf("attest call failed: %w", err)
+	}
+	if status < http.StatusOK || status >= http.StatusMultipleChoices {
+		return "", statusError("/attest", status, rawBody)
 	}
-	defer resp.Body.Close()
-
-	rawBody, _ := ioutil.ReadAll(resp.Body)
-	fmt.Printf("[DEBUG] Attest response status: %d:\n%s\n", resp.StatusCode, string(rawBody))
 
 	var result struct {
-		ItemID	string	`json:"itemid"`
-		Error	string	`json:"error"`
+		ItemID string `json:"itemid"`
+		Error  string `json:"error"`
 	}
 	if err := json.Unmarshal(rawBody, &result); err != nil {
 		return "", fmt.Errorf("Failed to parse attest response: %v", err)
 	}
 	if result.Error != "" {
-		return "", fmt.Errorf("JANE error: %s", result.Error)
+		return "", &APIError{Endpoint: "/attest", Status: status, Message: result.Error}
 	}
 	return result.ItemID, nil
 }
 
-// GetClaim retrieves a claim by its ID
-func GetClaim(janeURL, claimID string) (map[string]interface{}, error) {
-	endpoints := []string{
-		fmt.Sprintf("%s/claim/%s", janeURL, claimID),
-		fmt.Sprintf("%s/claims/%s", janeURL, claimID),
-	}
-	for _, url := range endpoints {
-		fmt.Printf("[DEBUG] Trying claim endpoint: %s\n", url)
-
-		maxAttempts := 60
-		for attempt := 1; attempt <= maxAttempts; attempt++ {
-			resp, err := http.Get(url)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get claim: %v", err)
-			}
-			defer resp.Body.Close()
-
-			fmt.Printf("[DEBUG] Attempt %d: Status %d\n", attempt, resp.StatusCode)
-
-			if resp.StatusCode == 200 {
-				var claim map[string]interface{}
-				if err := json.NewDecoder(resp.Body).Decode(&claim); err != nil {
-					return nil, fmt.Errorf("failed to decode claim: %v", err)
-				}
-				fmt.Errorf("[DEBUG] Successfully retrieved claim from %s!\n", url)
-				return claim, nil
-			} else if resp.StatusCode == 404 {
-				time.Sleep(100 * time.Millisecond)
-				continue
-			} else {
-				break
-			}
+// parameters makes sure JANE always receives an object, never null
+func parameters(params map[string]interface{}) map[string]interface{} {
+	if params == nil {
+		return map[string]interface{}{}
+	}
+	return params
+}
+
+// GetResult retrieves the result document of a verification by its ID.
+// The result is written before /verify returns, so unlike a claim it is not waited for.
+func (c *Client) GetResult(ctx context.Context, resultID string) (map[string]interface{}, error) {
+	paths := []string{
+		"/result/" + url.PathEscape(resultID),
+		"/results/" + url.PathEscape(resultID),
+	}
+	for _, path := range paths {
+		c.debugf("[DEBUG] Trying result endpoint: %s%s", c.BaseURL, path)
+
+		status, body, err := c.get(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get result: %w", err)
 		}
+		if status != http.StatusOK {
+			continue
+		}
+
+		var result map[string]interface{}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("failed to decode result: %v", err)
+		}
+		return result, nil
 	}
-	return nil, fmt.Errorf("claim %s was not found after trying all endpoints", claimID)
+	return nil, fmt.Errorf("result %s: %w after trying all endpoints", resultID, ErrNotFound)
 }
 
 // CreateSession creates a new JANE session and returns its ID
-func CreateSession(janeURL string) (string, error) {
-	resp, err := http.Post(janeURL+"/session", "application/json", nil)
+func (c *Client) CreateSession(ctx context.Context) (string, error) {
+	status, body, err := c.post(ctx, "/session", nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create session: %v", err)
+		return "", fmt.Errorf("failed to create session: %w", err)
+	}
+	if status < http.StatusOK || status >= http.StatusMultipleChoices {
+		return "", statusError("/session", status, body)
 	}
-	defer resp.Body.Close()
 
 	var res struct {
-		ItemID	string	`json:"itemid"`
-		Error	string	`json:"error"`
+		ItemID string `json:"itemid"`
+		Error  string `json:"error"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+	if err := json.Unmarshal(body, &res); err != nil {
 		return "", fmt.Errorf("failed to decode session response: %v", err)
 	}
 	if res.Error != "" {
-		return "", fmt.Errorf("session error: %s", res.Error)
+		return "", &APIError{Endpoint: "/session", Status: status, Message: res.Error}
 	}
 	return res.ItemID, nil
 }
 
 // CloseSession deletes a JANE session
-func CloseSession(janeURL, sessionID string) {
-	req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/session/%s", janeURL, sessionID), nil)
-	resp, err := http.DefaultClient.Do(req)
+func (c *Client) CloseSession(ctx context.Context, sessionID string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, "/session/"+url.PathEscape(sessionID), nil)
+	if err != nil {
+		return err
+	}
+	// sent once and past the breaker: closing is best effort cleanup that must still
+	// happen after the breaker opened during the run
+	if _, _, err := c.send(req); err != nil {
+		return fmt.Errorf("failed to close JANE session: %w", err)
+	}
+	return nil
+}
+
+// get performs a GET on path and returns the status code and the whole body
+func (c *Client) get(ctx context.Context, path string) (int, []byte, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	return c.roundTrip(req, true)
+}
+
+// post sends payload as JSON to path and returns the status code and the whole body.
+// A nil payload sends an empty body.
+func (c *Client) post(ctx context.Context, path string, payload interface{}) (int, []byte, error) {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to encode request: %v", err)
+		}
+		c.debugf("[DEBUG] Sending %s request:\n%s", path, string(data))
+		body = bytes.NewReader(data)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, path, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// creating a session is safe to repeat, attesting and verifying only if the RetryPolicy says so
+	status, rawBody, err := c.roundTrip(req, path == "/session")
+	if err == nil {
+		c.debugf("[DEBUG] %s response status: %d:\n%s", path, status, string(rawBody))
+	}
+	return status, rawBody, err
+}
+
+// roundTrip sends req, retrying it as the client's RetryPolicy allows
+func (c *Client) roundTrip(req *http.Request, idempotent bool) (int, []byte, error) {
+	return c.withRetries(req, idempotent, c.send)
+}
+
+// send makes a single attempt at req
+func (c *Client) send(req *http.Request) (int, []byte, error) {
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, nil, transportError(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Println("Failed to close JANE session:", err)
-	} else {
-		resp.Body.Close()
+		return resp.StatusCode, nil, fmt.Errorf("failed to read response: %v", err)
 	}
+	return resp.StatusCode, body, nil
 }
@@ -0,0 +1,361 @@
+package jane_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"janeauto/jane"
+	"janeauto/janetest"
+)
+
+func newClient(t *testing.T) (*janetest.Server, *jane.Client) {
+	t.Helper()
+	srv := janetest.New(t)
+	return srv, jane.NewClient(srv.URL, jane.WithTimeout(5*time.Second))
+}
+
+func TestGetElements(t *testing.T) {
+	srv, client := newClient(t)
+	srv.AddElement("e1", "web01", "prod", "web")
+	srv.AddElement("e2", "web02", "prod")
+	srv.AddElement("e3", "web01", "staging")
+	ctx := context.Background()
+
+	ids, err := client.GetElementsByName(ctx, "web01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, ",") != "e1,e3" {
+		t.Errorf("by name: got %v, want [e1 e3]", ids)
+	}
+
+	ids, err = client.GetElementsByTag(ctx, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, ",") != "e1,e2" {
+		t.Errorf("by tag: got %v, want [e1 e2]", ids)
+	}
+
+	srv.Fail("/elements/", http.StatusInternalServerError, "boom", 1)
+	if _, err := client.GetElementsByName(ctx, "web01"); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("want an error with the status, got %v", err)
+	}
+}
+
+func TestGetIntentItemID(t *testing.T) {
+	srv, client := newClient(t)
+	srv.AddIntent("i-42", "std::intent::sys::info")
+	ctx := context.Background()
+
+	id, err := client.GetIntentItemID(ctx, "std::intent::sys::info")
+	if err != nil || id != "i-42" {
+		t.Errorf("by name: got %q, %v", id, err)
+	}
+
+	// an ItemID is accepted as it is
+	id, err = client.GetIntentItemID(ctx, "i-42")
+	if err != nil || id != "i-42" {
+		t.Errorf("by ItemID: got %q, %v", id, err)
+	}
+
+	if _, err := client.GetIntentItemID(ctx, "nope"); err == nil {
+		t.Error("want an error for an unknown intent")
+	}
+}
+
+func TestListRulesAndEndpoints(t *testing.T) {
+	srv, client := newClient(t)
+	srv.AddRule("tpm2_quote", 0)
+	srv.AddRule("sys_info", 0)
+	srv.SetEndpoints("tarzan", "jane")
+	ctx := context.Background()
+
+	rules, err := client.ListRules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(rules, ",") != "sys_info,tpm2_quote" {
+		t.Errorf("rules: got %v", rules)
+	}
+	endpoints, err := client.ListEndpoints(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(endpoints, ",") != "tarzan,jane" {
+		t.Errorf("endpoints: got %v", endpoints)
+	}
+}
+
+func TestAttestVerifyRoundTrip(t *testing.T) {
+	srv, client := newClient(t)
+	srv.AddElement("e1", "web01")
+	srv.AddIntent("i1", "sys info")
+	srv.SetRule(janetest.Rule{Name: "check", Code: 9001, Details: map[string]interface{}{"message": "too old", "expected": "6.1", "actual": "5.4"}})
+	srv.ClaimDelay(3)
+	ctx := context.Background()
+
+	sid, err := client.CreateSession(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimID, err := client.RunAttestation(ctx, "e1", "i1", "tarzan", sid, map[string]interface{}{"pcrs": []int{0, 7}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the claim only appears after a few polls, of both /claim/ and /claims/
+	claim, waited, err := client.WaitForClaim(ctx, claimID, jane.ClaimWait{Interval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claim["element"] != "e1" {
+		t.Errorf("claim: got %v", claim)
+	}
+	if n := srv.Count("/claim"); n != 4 {
+		t.Errorf("got %d claim fetches, want 4", n)
+	}
+	if waited < 10*time.Millisecond {
+		t.Errorf("waited %v, want at least one interval", waited)
+	}
+
+	resultID, code, passed, err := client.RunVerification(ctx, claimID, "check", sid, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 9001 || passed {
+		t.Errorf("got code %d passed %v, want 9001 and not passed", code, passed)
+	}
+	verify := srv.Requests("/verify")[0]
+	if params, ok := verify.Body["parameters"].(map[string]interface{}); !ok || len(params) != 0 {
+		t.Errorf("nil parameters must be sent as {}, got %#v", verify.Body["parameters"])
+	}
+
+	result, err := client.GetResult(ctx, resultID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result["message"] != "too old" {
+		t.Errorf("result: got %v", result)
+	}
+
+	if err := client.CloseSession(ctx, sid); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.OpenSessions(); n != 0 {
+		t.Errorf("%d sessions left open", n)
+	}
+}
+
+func TestGetClaimFallsBackToClaims(t *testing.T) {
+	srv, client := newClient(t)
+	srv.AddElement("e1", "web01")
+	srv.AddIntent("i1", "sys info")
+	srv.ServeClaimsAt("/claims/")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	sid, _ := client.CreateSession(ctx)
+	claimID, err := client.RunAttestation(ctx, "e1", "i1", "tarzan", sid, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claim, err := client.GetClaim(ctx, claimID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claim["itemid"] != claimID {
+		t.Errorf("claim: got %v", claim)
+	}
+
+	// the next claim is only looked for where the first was found
+	before := srv.Count("/claim/")
+	claimID, _ = client.RunAttestation(ctx, "e1", "i1", "tarzan", sid, nil)
+	if _, err := client.GetClaim(ctx, claimID); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Count("/claim/"); n != before {
+		t.Errorf("got %d more /claim/ fetches, want none", n-before)
+	}
+}
+
+func TestWaitForClaimTimeout(t *testing.T) {
+	srv, client := newClient(t)
+	srv.AddElement("e1", "web01")
+	srv.AddIntent("i1", "sys info")
+	srv.ClaimDelay(1000)
+	ctx := context.Background()
+
+	sid, _ := client.CreateSession(ctx)
+	claimID, _ := client.RunAttestation(ctx, "e1", "i1", "tarzan", sid, nil)
+	_, waited, err := client.WaitForClaim(ctx, claimID, jane.ClaimWait{Timeout: 100 * time.Millisecond, Interval: 10 * time.Millisecond})
+	if !errors.Is(err, jane.ErrTimeout) {
+		t.Errorf("want ErrTimeout, got %v", err)
+	}
+	if waited < 100*time.Millisecond || waited > time.Second {
+		t.Errorf("waited %v", waited)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := client.GetClaim(cancelled, claimID); !errors.Is(err, context.Canceled) {
+		t.Errorf("want the context error, got %v", err)
+	}
+}
+
+func TestWaitForClaimJaneFailing(t *testing.T) {
+	srv := janetest.New(t)
+	srv.AddElement("e1", "web01")
+	srv.AddIntent("i1", "sys info")
+	client := jane.NewClient(srv.URL, jane.WithRetry(jane.RetryPolicy{Attempts: 1}))
+	ctx := context.Background()
+
+	sid, _ := client.CreateSession(ctx)
+	claimID, _ := client.RunAttestation(ctx, "e1", "i1", "tarzan", sid, nil)
+	srv.Fail("/claim", http.StatusServiceUnavailable, `{"error": "busy"}`, 1)
+	_, _, err := client.WaitForClaim(ctx, claimID, jane.ClaimWait{Timeout: time.Second, Interval: 10 * time.Millisecond})
+	var apiErr *jane.APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusServiceUnavailable || errors.Is(err, jane.ErrNotFound) {
+		t.Errorf("want a 503 API error that is not ErrNotFound, got %v", err)
+	}
+
+	// the outage did not rule out the prefix
+	if _, err := client.GetClaim(ctx, claimID); err != nil {
+		t.Errorf("after the outage: got %v", err)
+	}
+}
+
+func TestJaneErrors(t *testing.T) {
+	srv, client := newClient(t)
+	srv.AddElement("e1", "web01")
+	ctx := context.Background()
+
+	srv.Fail("/session", http.StatusOK, `{"error": "too many sessions"}`, 1)
+	_, err := client.CreateSession(ctx)
+	var apiErr *jane.APIError
+	if !errors.As(err, &apiErr) || apiErr.Endpoint != "/session" || apiErr.Message != "too many sessions" {
+		t.Errorf("session: got %v", err)
+	}
+
+	sid, err := client.CreateSession(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.RunAttestation(ctx, "e1", "missing-intent", "tarzan", sid, nil); err == nil || !strings.Contains(err.Error(), "missing-intent") {
+		t.Errorf("attest: got %v", err)
+	}
+	if _, _, _, err := client.RunVerification(ctx, "no-claim", "rule", sid, nil); err == nil {
+		t.Error("verify: want an error for an unknown claim")
+	}
+
+	srv.Fail("/elements/", http.StatusNotFound, `{"error": "no such name"}`, 1)
+	if _, err := client.GetElementsByName(ctx, "web01"); !errors.Is(err, jane.ErrNotFound) || errors.Is(err, jane.ErrTimeout) {
+		t.Errorf("elements: want ErrNotFound, got %v", err)
+	}
+	if _, err := client.GetIntentItemID(ctx, "nope"); !errors.Is(err, jane.ErrNotFound) {
+		t.Errorf("intent: want ErrNotFound, got %v", err)
+	}
+}
+
+func TestJSONBodiedErrorStatus(t *testing.T) {
+	srv, client := newClient(t)
+	srv.AddElement("e1", "web01")
+	srv.AddIntent("i1", "sys info")
+	ctx := context.Background()
+	sid, err := client.CreateSession(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := []struct {
+		endpoint string
+		status   int
+		call     func() error
+	}{
+		{"/session", http.StatusInternalServerError, func() error {
+			_, err := client.CreateSession(ctx)
+			return err
+		}},
+		{"/attest", http.StatusBadRequest, func() error {
+			_, err := client.RunAttestation(ctx, "e1", "i1", "tarzan", sid, nil)
+			return err
+		}},
+		{"/verify", http.StatusNotFound, func() error {
+			_, _, _, err := client.RunVerification(ctx, "c1", "rule", sid, nil)
+			return err
+		}},
+	}
+	for _, tc := range calls {
+		srv.Fail(tc.endpoint, tc.status, `{"detail": "boom"}`, 1)
+		var apiErr *jane.APIError
+		if err := tc.call(); !errors.As(err, &apiErr) || apiErr.Endpoint != tc.endpoint || apiErr.Status != tc.status {
+			t.Errorf("%s: want an API error with status %d, got %v", tc.endpoint, tc.status, err)
+		}
+	}
+}
+
+func TestRetries(t *testing.T) {
+	srv := janetest.New(t)
+	srv.AddElement("e1", "web01")
+	srv.AddIntent("i1", "sys info")
+	retry := jane.RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond}
+	client := jane.NewClient(srv.URL, jane.WithRetry(retry))
+	ctx := context.Background()
+
+	srv.Fail("/elements/", http.StatusServiceUnavailable, "", 2)
+	if _, err := client.GetElementsByName(ctx, "web01"); err != nil || srv.Count("/elements/") != 3 {
+		t.Errorf("GET: got %v after %d calls, want success after 3", err, srv.Count("/elements/"))
+	}
+
+	sid, _ := client.CreateSession(ctx)
+	srv.Fail("/attest", http.StatusServiceUnavailable, "", 1)
+	if _, err := client.RunAttestation(ctx, "e1", "i1", "tarzan", sid, nil); err == nil || srv.Count("/attest") != 1 {
+		t.Errorf("attest is not retried by default, got %v after %d calls", err, srv.Count("/attest"))
+	}
+
+	retry.Mutating = true
+	client = jane.NewClient(srv.URL, jane.WithRetry(retry))
+	srv.Fail("/attest", http.StatusServiceUnavailable, "", 1)
+	if _, err := client.RunAttestation(ctx, "e1", "i1", "tarzan", sid, nil); err != nil {
+		t.Errorf("attest with Mutating: got %v", err)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	srv := janetest.New(t)
+	client := jane.NewClient(srv.URL, jane.WithRetry(jane.RetryPolicy{Attempts: 1}), jane.WithBreaker(2, 50*time.Millisecond))
+	ctx := context.Background()
+	sid, err := client.CreateSession(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Fail("/intents", http.StatusServiceUnavailable, "", 2)
+	client.ListIntents(ctx)
+	client.ListIntents(ctx)
+	if _, err := client.ListIntents(ctx); !errors.Is(err, jane.ErrCircuitOpen) || srv.Count("/intents") != 2 {
+		t.Errorf("open: got %v after %d calls", err, srv.Count("/intents"))
+	}
+	if err := client.CloseSession(ctx, sid); err != nil || srv.OpenSessions() != 0 {
+		t.Errorf("closing a session while open: got %v, %d sessions open", err, srv.OpenSessions())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := client.ListIntents(ctx); err != nil {
+		t.Errorf("after the cooldown: got %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	srv := janetest.New(t)
+	srv.Delay("/intents", time.Second)
+	client := jane.NewClient(srv.URL, jane.WithTimeout(50*time.Millisecond))
+
+	if _, err := client.ListIntents(context.Background()); !errors.Is(err, jane.ErrTimeout) {
+		t.Errorf("want ErrTimeout, got %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package jane
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling JANE while its circuit breaker is open, see WithBreaker
+var ErrCircuitOpen = errors.New("JANE circuit breaker is open")
+
+// RetryPolicy says how failed JANE calls are retried. A call is retried when JANE could not
+// be reached or answered 429, 502, 503 or 504. The wait doubles with every retry, up to
+// MaxDelay, and is randomly shortened by up to half so that parallel elements spread out.
+//
+// GETs, DELETEs and session creation are always retried. /attest and /verify are only
+// retried with Mutating, since JANE may have acted on a request whose answer was lost.
+type RetryPolicy struct {
+	Attempts  int           // tries per call including the first, 1 or less means no retries
+	BaseDelay time.Duration // wait before the first retry
+	MaxDelay  time.Duration
+	Mutating  bool // also retry /attest and /verify
+}
+
+// DefaultRetry is the RetryPolicy of a Client built without WithRetry
+var DefaultRetry = RetryPolicy{Attempts: 3, BaseDelay: 200 * time.Millisecond, MaxDelay: 5 * time.Second}
+
+// default circuit breaker of a Client built without WithBreaker
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// WithRetry sets how failed calls are retried
+func WithRetry(p RetryPolicy) Option {
+	return func(c *Client) { c.Retry = p }
+}
+
+// WithBreaker opens the client's circuit breaker after threshold calls in a row failed because
+// JANE was unreachable or unavailable. While it is open every call fails with ErrCircuitOpen.
+// After cooldown one call is let through, and the breaker closes again if it succeeds.
+// A threshold of 0 turns the breaker off.
+func WithBreaker(threshold int, cooldown time.Duration) Option {
+	return func(c *Client) { c.breaker = &breaker{threshold: threshold, cooldown: cooldown} }
+}
+
+// backoff returns the wait before retry number n, counted from 1
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < n && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryable reports whether a call that ended with status and err is worth another try
+func retryable(ctx context.Context, status int, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return unavailable(status)
+}
+
+func unavailable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// outcome of a call as the circuit breaker sees it
+type outcome int
+
+const (
+	callSucceeded outcome = iota // JANE answered, even with an error
+	callFailed                   // JANE was unreachable or unavailable
+	callAborted                  // the caller gave up, which says nothing about JANE
+)
+
+func outcomeOf(ctx context.Context, status int, err error) outcome {
+	switch {
+	case ctx.Err() != nil:
+		return callAborted
+	case err != nil || status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout:
+		return callFailed
+	}
+	return callSucceeded
+}
+
+// breaker is the circuit breaker of one Client, and so of one JANE instance
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int       // calls in a row that failed
+	openUntil time.Time // no calls before this once failures reached threshold
+	probing   bool      // a call is finding out whether JANE is back
+}
+
+// allow returns ErrCircuitOpen if the call must not be made
+func (b *breaker) allow() error {
+	if b == nil || b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return nil
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return ErrCircuitOpen
+	}
+	b.probing = true
+	return nil
+}
+
+func (b *breaker) record(o outcome) {
+	if b == nil || b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	switch o {
+	case callSucceeded:
+		b.failures = 0
+	case callFailed:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.openUntil = time.Now().Add(b.cooldown)
+		}
+	}
+}
+
+// withRetries sends req through send, retrying as the client's RetryPolicy says.
+// retry is false for calls JANE may not see twice unless the policy allows it.
+func (c *Client) withRetries(req *http.Request, retry bool, send func(*http.Request) (int, []byte, error)) (int, []byte, error) {
+	ctx := req.Context()
+	attempts := 1
+	if retry || c.Retry.Mutating {
+		attempts = c.Retry.Attempts
+	}
+	for n := 1; ; n++ {
+		if err := c.breaker.allow(); err != nil {
+			return 0, nil, fmt.Errorf("%w: %s", err, c.BaseURL)
+		}
+		status, body, err := send(req)
+		c.breaker.record(outcomeOf(ctx, status, err))
+		if n >= attempts || !retryable(ctx, status, err) {
+			return status, body, err
+		}
+
+		wait := c.Retry.backoff(n)
+		c.debugf("[DEBUG] %s %s failed (status %d, %v), retry %d of %d in %v", req.Method, req.URL.Path, status, err, n, attempts-1, wait)
+		select {
+		case <-ctx.Done():
+			return status, body, err
+		case <-time.After(wait):
+		}
+		if req, err = rewind(req); err != nil {
+			return 0, nil, err
+		}
+	}
+}
+
+// rewind returns a copy of req whose body can be sent again
+func rewind(req *http.Request) (*http.Request, error) {
+	next := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		next.Body = body
+	}
+	return next, nil
+}
@@ -0,0 +1,431 @@
+// Package janetest runs an in-process fake JANE for tests.
+//
+// A Server answers the parts of the JANE API janeauto uses: intents, elements, sessions,
+// /attest, /verify, claims and results, rules and endpoints. Tests script it with elements,
+// intents, rules and their result codes, and can delay or fail any endpoint.
+package janetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Element is an element known to the fake JANE
+type Element struct {
+	ID   string
+	Name string
+	Tags []string
+}
+
+// Rule is a rule /verify can run. Code is the result code returned for every claim;
+// Details are added to the rule's result document, e.g. "message", "expected" and "actual".
+type Rule struct {
+	Name    string
+	Code    int
+	Details map[string]interface{}
+}
+
+// Request is a request the server received
+type Request struct {
+	Method string
+	Path   string
+	Body   map[string]interface{}
+}
+
+// fault makes requests to a path fail
+type fault struct {
+	prefix string
+	status int
+	body   string
+	times  int // 0 means every request
+}
+
+// Server is a fake JANE. Create it with New; its URL is the JANE base URL.
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	elements   []Element
+	intents    map[string]string // ItemID -> name
+	rules      map[string]Rule
+	endpoints  []string
+	claimPaths []string
+	claimDelay int
+
+	claims   map[string]map[string]interface{}
+	polls    map[string]int
+	results  map[string]map[string]interface{}
+	sessions map[string]bool
+	faults   []*fault
+	delays   map[string]time.Duration
+	requests []Request
+	nextID   int
+}
+
+// New starts a fake JANE that is shut down when the test ends.
+// It knows the endpoint "tarzan" and serves claims under both /claim/ and /claims/.
+func New(t testing.TB) *Server {
+	s := &Server{
+		intents:    make(map[string]string),
+		rules:      make(map[string]Rule),
+		endpoints:  []string{"tarzan"},
+		claimPaths: []string{"/claim/", "/claims/"},
+		claims:     make(map[string]map[string]interface{}),
+		polls:      make(map[string]int),
+		results:    make(map[string]map[string]interface{}),
+		sessions:   make(map[string]bool),
+		delays:     make(map[string]time.Duration),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// AddElement adds an element with a name and tags
+func (s *Server) AddElement(id, name string, tags ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.elements = append(s.elements, Element{ID: id, Name: name, Tags: tags})
+}
+
+// AddIntent adds an intent; /intents lists its name and /intents/name/{name} resolves it to id
+func (s *Server) AddIntent(id, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.intents[id] = name
+}
+
+// AddRule adds a rule that returns code for every claim
+func (s *Server) AddRule(name string, code int) {
+	s.SetRule(Rule{Name: name, Code: code})
+}
+
+// SetRule adds or replaces a rule
+func (s *Server) SetRule(r Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules[r.Name] = r
+}
+
+// SetEndpoints replaces the endpoints /attest accepts
+func (s *Server) SetEndpoints(names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.endpoints = names
+}
+
+// ServeClaimsAt sets the path prefixes claims are served under, e.g. only "/claims/"
+func (s *Server) ServeClaimsAt(prefixes ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.claimPaths = prefixes
+}
+
+// ClaimDelay makes each claim answer 404 to its first n fetches, as JANE does while it is still collecting
+func (s *Server) ClaimDelay(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.claimDelay = n
+}
+
+// Delay holds every response to a path starting with prefix for d
+func (s *Server) Delay(prefix string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delays[prefix] = d
+}
+
+// Fail answers requests to paths starting with prefix with status and body.
+// It fails the next times requests, or every request if times is 0.
+func (s *Server) Fail(prefix string, status int, body string, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &fault{prefix: prefix, status: status, body: body, times: times})
+}
+
+// Requests returns the requests received so far whose path starts with prefix
+func (s *Server) Requests(prefix string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Request
+	for _, r := range s.requests {
+		if strings.HasPrefix(r.Path, prefix) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Count returns how many requests to paths starting with prefix were received
+func (s *Server) Count(prefix string) int {
+	return len(s.Requests(prefix))
+}
+
+// OpenSessions returns the number of sessions created and not yet closed
+func (s *Server) OpenSessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, open := range s.sessions {
+		if open {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+		json.Unmarshal(data, &body)
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Body: body})
+	var delay time.Duration
+	for prefix, d := range s.delays {
+		if strings.HasPrefix(r.URL.Path, prefix) && d > delay {
+			delay = d
+		}
+	}
+	f := s.takeFault(r.URL.Path)
+	s.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if f != nil {
+		w.WriteHeader(f.status)
+		io.WriteString(w, f.body)
+		return
+	}
+
+	s.mu.Lock()
+	status, resp := s.route(r.Method, r.URL.Path, body)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// takeFault returns the fault for path, using up one of its times
+func (s *Server) takeFault(path string) *fault {
+	for i, f := range s.faults {
+		if !strings.HasPrefix(path, f.prefix) {
+			continue
+		}
+		if f.times > 0 {
+			f.times--
+			if f.times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func (s *Server) route(method, path string, body map[string]interface{}) (int, interface{}) {
+	notFound := map[string]interface{}{"error": "not found"}
+	switch {
+	case method == http.MethodGet && path == "/intents":
+		names := []string{}
+		for _, name := range s.intents {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return http.StatusOK, map[string]interface{}{"intents": names, "length": len(names)}
+
+	case method == http.MethodGet && strings.HasPrefix(path, "/intents/name/"):
+		name := strings.TrimPrefix(path, "/intents/name/")
+		ids := []string{}
+		for id, n := range s.intents {
+			if strings.ReplaceAll(n, " ", "") == name {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		return http.StatusOK, map[string]interface{}{"intents": ids, "length": len(ids)}
+
+	case method == http.MethodGet && strings.HasPrefix(path, "/intent/"):
+		id := strings.TrimPrefix(path, "/intent/")
+		if name, ok := s.intents[id]; ok {
+			return http.StatusOK, map[string]interface{}{"itemid": id, "name": name}
+		}
+		return http.StatusNotFound, notFound
+
+	case method == http.MethodGet && strings.HasPrefix(path, "/elements/name/"):
+		name := strings.TrimPrefix(path, "/elements/name/")
+		return http.StatusOK, s.elementList(func(e Element) bool { return e.Name == name })
+
+	case method == http.MethodGet && strings.HasPrefix(path, "/elements/tag/"):
+		tag := strings.TrimPrefix(path, "/elements/tag/")
+		return http.StatusOK, s.elementList(func(e Element) bool {
+			for _, t := range e.Tags {
+				if t == tag {
+					return true
+				}
+			}
+			return false
+		})
+
+	case method == http.MethodGet && path == "/rules":
+		names := []string{}
+		for name := range s.rules {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return http.StatusOK, map[string]interface{}{"rules": names}
+
+	case method == http.MethodGet && path == "/endpoints":
+		return http.StatusOK, map[string]interface{}{"endpoints": s.endpoints}
+
+	case method == http.MethodPost && path == "/session":
+		id := s.newID("session")
+		s.sessions[id] = true
+		return http.StatusCreated, map[string]interface{}{"itemid": id}
+
+	case method == http.MethodDelete && strings.HasPrefix(path, "/session/"):
+		id := strings.TrimPrefix(path, "/session/")
+		if !s.sessions[id] {
+			return http.StatusNotFound, notFound
+		}
+		s.sessions[id] = false
+		return http.StatusOK, map[string]interface{}{}
+
+	case method == http.MethodPost && path == "/attest":
+		return s.attest(body)
+
+	case method == http.MethodPost && path == "/verify":
+		return s.verify(body)
+
+	case method == http.MethodGet && strings.HasPrefix(path, "/result/"), method == http.MethodGet && strings.HasPrefix(path, "/results/"):
+		id := path[strings.LastIndex(path, "/")+1:]
+		if res, ok := s.results[id]; ok {
+			return http.StatusOK, res
+		}
+		return http.StatusNotFound, notFound
+
+	case method == http.MethodGet:
+		for _, prefix := range s.claimPaths {
+			if strings.HasPrefix(path, prefix) {
+				return s.claim(strings.TrimPrefix(path, prefix))
+			}
+		}
+	}
+	return http.StatusNotFound, notFound
+}
+
+func (s *Server) elementList(match func(Element) bool) map[string]interface{} {
+	ids := []string{}
+	for _, e := range s.elements {
+		if match(e) {
+			ids = append(ids, e.ID)
+		}
+	}
+	return map[string]interface{}{"elements": ids, "length": len(ids)}
+}
+
+func (s *Server) attest(body map[string]interface{}) (int, interface{}) {
+	eid, _ := body["eid"].(string)
+	pid, _ := body["pid"].(string)
+	epn, _ := body["epn"].(string)
+	sid, _ := body["sid"].(string)
+
+	switch {
+	case !s.sessions[sid]:
+		return http.StatusOK, map[string]interface{}{"error": fmt.Sprintf("session %s is not open", sid)}
+	case !s.hasElement(eid):
+		return http.StatusOK, map[string]interface{}{"error": fmt.Sprintf("element %s not found", eid)}
+	case s.intents[pid] == "":
+		return http.StatusOK, map[string]interface{}{"error": fmt.Sprintf("intent %s not found", pid)}
+	case !contains(s.endpoints, epn):
+		return http.StatusOK, map[string]interface{}{"error": fmt.Sprintf("endpoint %s not known", epn)}
+	}
+
+	id := s.newID("claim")
+	s.claims[id] = map[string]interface{}{
+		"itemid":     id,
+		"element":    eid,
+		"intent":     pid,
+		"endpoint":   epn,
+		"session":    sid,
+		"parameters": body["parameters"],
+	}
+	return http.StatusCreated, map[string]interface{}{"itemid": id}
+}
+
+func (s *Server) verify(body map[string]interface{}) (int, interface{}) {
+	cid, _ := body["cid"].(string)
+	name, _ := body["rule"].(string)
+
+	if _, ok := s.claims[cid]; !ok {
+		return http.StatusOK, map[string]interface{}{"error": fmt.Sprintf("claim %s not found", cid)}
+	}
+	rule, ok := s.rules[name]
+	if !ok {
+		return http.StatusOK, map[string]interface{}{"error": fmt.Sprintf("rule %s not found", name)}
+	}
+
+	id := s.newID("result")
+	res := map[string]interface{}{
+		"itemid":     id,
+		"claim":      cid,
+		"rule":       name,
+		"result":     rule.Code,
+		"parameters": body["parameters"],
+	}
+	for k, v := range rule.Details {
+		res[k] = v
+	}
+	s.results[id] = res
+	return http.StatusCreated, map[string]interface{}{"itemid": id, "result": rule.Code}
+}
+
+func (s *Server) claim(id string) (int, interface{}) {
+	claim, ok := s.claims[id]
+	if !ok {
+		return http.StatusNotFound, map[string]interface{}{"error": "not found"}
+	}
+	s.polls[id]++
+	if s.polls[id] <= s.claimDelay {
+		return http.StatusNotFound, map[string]interface{}{"error": "not found"}
+	}
+	return http.StatusOK, claim
+}
+
+func (s *Server) hasElement(id string) bool {
+	for _, e := range s.elements {
+		if e.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) newID(kind string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%d", kind, s.nextID)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
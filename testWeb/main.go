@@ -3,12 +3,16 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 
+	"janeauto/attestor"
 	"janeauto/config"
 	"janeauto/db"
+	"janeauto/runner"
+	"janeauto/scheduler"
 	"janeauto/web"
 )
 
@@ -20,7 +24,21 @@ func main() {
 	fmt.Println("Mongo URI:", config.ConfigData.Database.Connection)
 	fmt.Println("JANE URL:", config.ConfigData.Jane.URL)
 
-	db.Connect(config.ConfigData.Database.Connection)
+	attestor.Setup(config.ConfigData)
+
+	db.Connect(config.ConfigData.Database.Connection, config.ConfigData.Database.Name)
+
+	runner.Start(config.ConfigData.Runner.Workers, config.ConfigData.Runner.QueueSize, config.ConfigData.Runner.Retention)
+	if dir := config.ConfigData.Runner.RecordDir; dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Fatalf("cannot create the cassette directory: %v", err)
+		}
+		runner.RecordTo(dir)
+	}
+
+	if config.ConfigData.Scheduler.Enabled {
+		scheduler.Start(runner.Submit, runner.Active, config.ConfigData.Scheduler.ReloadInterval)
+	}
 
 	e := echo.New()
 
@@ -30,11 +48,45 @@ func main() {
 	e.GET("/", web.HomeHandler)
 	e.GET("/attest", web.AttestFormHandler)
 	e.GET("/policies", web.PoliciesHandler)
+	e.GET("/policies/import", web.ImportFormHandler)
+	e.POST("/policies/import", web.ImportUploadHandler)
+	e.GET("/policies/:name/plan", web.PlanPageHandler)
+	e.GET("/policies/:name/lint", web.LintPageHandler)
+	e.GET("/policies/:name/history", web.HistoryPageHandler)
+	e.GET("/policies/:name/diff", web.DiffPageHandler)
+	e.POST("/policies/:name/revisions/:rev/restore", web.RestoreRevisionHandler)
 	e.GET("/debug-jane", web.DebugJaneHandler)
 
 	e.POST("/attest/run", web.AttestRunHandler)
 	e.POST("/execute/:policyName", web.ExecutePolicyHandler)
+	e.GET("/runs/:id", web.RunPageHandler)
+	e.GET("/runs/:id/events", web.RunEventsHandler)
+	e.POST("/runs/:id/cancel", web.CancelRunHandler)
+
+	api := e.Group("/api/v1")
+	api.GET("/policies", web.APIListPoliciesHandler)
+	api.POST("/policies", web.APICreatePolicyHandler)
+	api.GET("/policies/:name", web.APIGetPolicyHandler)
+	api.PUT("/policies/:name", web.APIUpdatePolicyHandler)
+	api.PATCH("/policies/:name", web.APIPatchPolicyHandler)
+	api.DELETE("/policies/:name", web.APIDeletePolicyHandler)
+	api.GET("/policies/:name/plan", web.APIPlanPolicyHandler)
+	api.GET("/policies/:name/lint", web.APILintPolicyHandler)
+	api.GET("/policies/:name/revisions", web.APIListRevisionsHandler)
+	api.GET("/policies/:name/revisions/:rev", web.APIGetRevisionHandler)
+	api.GET("/policies/:name/revisions/:rev/diff", web.APIDiffRevisionHandler)
+	api.POST("/policies/:name/revisions/:rev/restore", web.APIRestoreRevisionHandler)
+	api.POST("/lint", web.APILintHandler)
+	api.GET("/runs", web.APIListRunsHandler)
+	api.POST("/runs", web.APISubmitRunHandler)
+	api.GET("/runs/:id", web.APIGetRunHandler)
+	api.DELETE("/runs/:id", web.APICancelRunHandler)
+	api.GET("/schedules", web.APIListSchedulesHandler)
+	api.GET("/schedules/:name", web.APIGetScheduleHandler)
 
-	addr := fmt.Sprintf(":%d", config.ConfigData.Rest.Port)
-	log.Fatal(e.Start(addr))
+	addr := fmt.Sprintf("%s:%d", config.ConfigData.Rest.ListenOn, config.ConfigData.Rest.Port)
+	if config.ConfigData.Rest.UseHTTP {
+		log.Fatal(e.Start(addr))
+	}
+	log.Fatal(e.StartTLS(addr, config.ConfigData.Rest.CertFile, config.ConfigData.Rest.KeyFile))
 }
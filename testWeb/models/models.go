@@ -1,42 +1,138 @@
 package models
 
+import (
+	"strings"
+	"time"
+)
+
 type Policy struct {
 	Name         string           `bson:"name" json:"name"`
 	Description  string           `bson:"description" json:"description"`
 	Jane         string           `bson:"jane" json:"jane"`
 	Collection   PolicyCollection `bson:"collection" json:"collection"`
 	Attestations []AttestItem     `bson:"attestations" json:"attestations"`
+	Schedule     *Schedule        `bson:"schedule,omitempty" json:"schedule,omitempty"`
+	ResultCodes  ResultCodes      `bson:"resultcodes,omitempty" json:"resultcodes,omitempty"` // overrides the configured catalogue
+	Source       string           `bson:"source,omitempty" json:"source,omitempty"`           // where the policy is managed, one of the Source constants
+	Revision     int              `bson:"revision,omitempty" json:"revision,omitempty"`       // number of the Revision this document was saved as
+}
+
+// Where a policy is managed. Reconciling a policy directory only deletes policies that came from files.
+const (
+	SourceAPI  = "api"  // created through the JSON API or the web UI
+	SourceFile = "file" // loaded from a policy file by cmd/loader
+)
+
+// Schedule makes a policy run on its own. Cron is a standard five-field cron expression
+// (or a descriptor such as "@hourly"), evaluated in Timezone (default UTC).
+// Each run is delayed by a random amount up to Jitter, e.g. "30s", to spread load on JANE.
+type Schedule struct {
+	Cron     string `bson:"cron" json:"cron"`
+	Jitter   string `bson:"jitter,omitempty" json:"jitter,omitempty"`
+	Timezone string `bson:"timezone,omitempty" json:"timezone,omitempty"`
 }
 
 type AttestItem struct {
-	Intent   string `bson:"intent" json:"intent"`
-	Endpoint string `bson:"endpoint" json:"endpoint"`
-	Rules    []Rule `bson:"rules" json:"rules"`
+	Intent     string     `bson:"intent" json:"intent"`
+	Endpoint   string     `bson:"endpoint" json:"endpoint"`
+	Parameters Parameters `bson:"parameters,omitempty" json:"parameters,omitempty"` // forwarded to /attest
+	Rules      []Rule     `bson:"rules" json:"rules"`
 }
 
 type Rule struct {
-	Name      string `bson:"name"	  json:"name"`
-	RVariable string `bson:"rvariable" json:"rvariable"`
-	Parameter string `bson:"parameter" json:"parameter"`
-	Decision  string `bson:"decision"  json:"decision"`
+	Name      string     `bson:"name"      json:"name"`
+	RVariable string     `bson:"rvariable" json:"rvariable"`
+	Parameter Parameters `bson:"parameter,omitempty" json:"parameter,omitempty"` // forwarded to /verify
+	Decision  string     `bson:"decision"  json:"decision"`                      // one of the Decision constants, "" means required
+}
+
+// How a rule's outcome feeds the verdict of its attestation
+const (
+	DecisionRequired = "required"  // a rule that does not pass fails the attestation
+	DecisionAdvisory = "advisory"  // a rule that does not pass adds a warning
+	DecisionIgnore   = "ignore"    // the result is only recorded
+	DecisionFailFast = "fail-fast" // like required, and a failure stops the element's remaining rules and attestations
+)
+
+// EffectiveDecision returns the rule's Decision, defaulting to DecisionRequired
+func (r Rule) EffectiveDecision() string {
+	if r.Decision == "" {
+		return DecisionRequired
+	}
+	return strings.ToLower(r.Decision)
 }
 
 type PolicyCollection struct {
-	Items []string `bson:"items" json:"items"`
-	Tags  []string `bson:"tags" json:"tags"`
-	Names []string `bson:"names" json:"names"`
+	Items    []string `bson:"items" json:"items"`
+	Tags     []string `bson:"tags" json:"tags"`
+	Names    []string `bson:"names" json:"names"`
+	TagMatch string   `bson:"tagmatch,omitempty" json:"tagmatch,omitempty"` // "or" (default) or "and"
 }
 
+// How multiple Collection.Tags are combined
+const (
+	TagMatchOr  = "or"  // element carries at least one of the tags
+	TagMatchAnd = "and" // element carries every tag
+)
+
 type AttestationResult struct {
 	ElementID   string                   `bson:"element_id" json:"element_id"`
 	ElementName string		     `bson:"element_name" json:"element_name"`
 	Intent      string                   `bson:"intent" json:"intent"`
 	Claim       interface{}              `bson:"claim" json:"claim"`
-	Passed      bool                     `bson:"passed" json:"passed"`
+	Status      string                   `bson:"status" json:"status"` // one of the Status constants
+	Passed      bool                     `bson:"passed" json:"passed"` // Status is pass
 	RuleResults []map[string]interface{} `bson:"rule_results" json:"rule_results"`
 	ClaimID     string                   `bson:"claim_id" json:"claim_id"`
+	ClaimWaitMs int64                    `bson:"claim_wait_ms,omitempty" json:"claim_wait_ms,omitempty"` // how long the claim took to appear, or was waited for
+	SelectedBy  []string                 `bson:"selected_by" json:"selected_by"`
+	Warnings    []string                 `bson:"warnings,omitempty" json:"warnings,omitempty"`     // advisory rules that did not pass
+	StoppedBy   string                   `bson:"stopped_by,omitempty" json:"stopped_by,omitempty"` // fail-fast rule that ended the element's attestation
+	Error       *ResultError             `bson:"error,omitempty" json:"error,omitempty"`           // why Status is error, if JANE failed
+	RunID       string                   `bson:"run_id,omitempty" json:"run_id,omitempty"`
+	Policy      string                   `bson:"policy,omitempty" json:"policy,omitempty"`
+	Time        time.Time                `bson:"time" json:"time"`
+}
+
+// Run is one execution of a policy. Its AttestationResults are stored separately and point back via RunID.
+type Run struct {
+	ID          string           `bson:"_id" json:"id"`
+	PolicyName  string           `bson:"policy" json:"policy"`
+	Policy      Policy           `bson:"policy_snapshot" json:"policy_snapshot"`
+	Revision    int              `bson:"policy_revision,omitempty" json:"policy_revision,omitempty"` // revision of the policy that ran
+	JaneURL     string           `bson:"jane_url" json:"jane_url"`
+	SessionID   string           `bson:"session_id" json:"session_id"`
+	TriggeredBy string           `bson:"triggered_by" json:"triggered_by"`
+	Status      string           `bson:"status" json:"status"`
+	QueuedAt    time.Time        `bson:"queued_at" json:"queued_at"`
+	StartedAt   time.Time        `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	FinishedAt  time.Time        `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+	Verdict     string           `bson:"verdict" json:"verdict"`
+	Warnings    int              `bson:"warnings" json:"warnings"` // number of advisory warnings across all results
+	Elements    []ElementVerdict `bson:"elements,omitempty" json:"elements,omitempty"`
+	Error       string           `bson:"error,omitempty" json:"error,omitempty"`
+	ResultCount int              `bson:"result_count" json:"result_count"`
 }
 
+// Lifecycle states of a Run
+const (
+	RunQueued    = "queued"
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+	RunCancelled = "cancelled"
+	RunJaneDown  = "jane_unavailable" // JANE's circuit breaker opened and the rest of the run failed fast
+)
+
+// Overall verdicts of a Run, the Status constants plus warn
+const (
+	VerdictPass    = StatusPass
+	VerdictWarn    = "warn" // passed, but advisory rules did not
+	VerdictFail    = StatusFail
+	VerdictError   = StatusError
+	VerdictSkipped = StatusSkipped
+)
+
 type Item struct {
 	ID       string   `json:"id"`
 	Elements []string `json:"elements"`
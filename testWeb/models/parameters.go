@@ -0,0 +1,92 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// Parameters are the inputs forwarded to JANE in the "parameters" object of /attest and /verify.
+//
+// Older policies stored a rule's parameter as a plain string. Such strings are still accepted
+// when decoding: an empty string means no parameters, a string holding a JSON object is parsed
+// as that object, and anything else is read as comma separated key=value pairs. A string that
+// is none of these is kept whole under the "value" key.
+type Parameters map[string]interface{}
+
+// UnmarshalJSON accepts an object, null or a legacy string
+func (p *Parameters) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*p = parseLegacy(s)
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("parameters must be an object or a string: %v", err)
+	}
+	*p = m
+	return nil
+}
+
+// UnmarshalBSONValue accepts an embedded document, null or a legacy string
+func (p *Parameters) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.Null, bsontype.Undefined:
+		*p = nil
+		return nil
+	case bsontype.String:
+		var s string
+		raw := bson.RawValue{Type: t, Value: data}
+		if err := raw.Unmarshal(&s); err != nil {
+			return err
+		}
+		*p = parseLegacy(s)
+		return nil
+	case bsontype.EmbeddedDocument:
+		dec, err := bson.NewDecoder(bsonrw.NewBSONDocumentReader(data))
+		if err != nil {
+			return err
+		}
+		// nested documents become maps so they serialise to JSON objects for JANE
+		dec.DefaultDocumentM()
+		var m map[string]interface{}
+		if err := dec.Decode(&m); err != nil {
+			return err
+		}
+		*p = m
+		return nil
+	}
+	return fmt.Errorf("cannot decode %v into parameters", t)
+}
+
+// parseLegacy never fails, so one odd stored string cannot break decoding a whole list of
+// policies. A string that is neither a JSON object nor key=value pairs is kept as {"value": s}.
+func parseLegacy(s string) Parameters {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	if strings.HasPrefix(s, "{") {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(s), &m); err != nil {
+			return Parameters{"value": s}
+		}
+		return m
+	}
+
+	m := make(Parameters)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return Parameters{"value": s}
+		}
+		m[key] = strings.TrimSpace(value)
+	}
+	return m
+}
@@ -0,0 +1,77 @@
+package models_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"janeauto/models"
+)
+
+var legacyParameters = []struct {
+	name   string
+	stored string
+	want   models.Parameters
+}{
+	{"empty", "  ", nil},
+	{"json object", `{"pcr": 0, "bank": "sha256"}`, models.Parameters{"pcr": float64(0), "bank": "sha256"}},
+	{"key value pairs", "pcr=0, bank = sha256", models.Parameters{"pcr": "0", "bank": "sha256"}},
+	{"malformed json", `{"pcr": 0`, models.Parameters{"value": `{"pcr": 0`}},
+	{"no equals sign", "sha256", models.Parameters{"value": "sha256"}},
+	{"missing key", "=0", models.Parameters{"value": "=0"}},
+}
+
+func TestLegacyParametersJSON(t *testing.T) {
+	for _, tc := range legacyParameters {
+		data, _ := json.Marshal(map[string]string{"name": "r", "parameter": tc.stored})
+		var rule models.Rule
+		if err := json.Unmarshal(data, &rule); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(rule.Parameter, tc.want) {
+			t.Errorf("%s: got %#v, want %#v", tc.name, rule.Parameter, tc.want)
+		}
+	}
+}
+
+func TestLegacyParametersBSON(t *testing.T) {
+	for _, tc := range legacyParameters {
+		data, err := bson.Marshal(bson.M{"name": "r", "parameter": tc.stored})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rule models.Rule
+		if err := bson.Unmarshal(data, &rule); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(rule.Parameter, tc.want) {
+			t.Errorf("%s: got %#v, want %#v", tc.name, rule.Parameter, tc.want)
+		}
+	}
+}
+
+func TestParametersBSONDocument(t *testing.T) {
+	data, err := bson.Marshal(bson.M{"parameter": bson.M{"pcr": int32(0), "opts": bson.M{"bank": "sha256"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rule models.Rule
+	if err := bson.Unmarshal(data, &rule); err != nil {
+		t.Fatal(err)
+	}
+	want := models.Parameters{"pcr": int32(0), "opts": bson.M{"bank": "sha256"}}
+	if !reflect.DeepEqual(rule.Parameter, want) {
+		t.Errorf("got %#v, want %#v", rule.Parameter, want)
+	}
+}
+
+func TestParametersRejectNonObjects(t *testing.T) {
+	var p models.Parameters
+	if err := json.Unmarshal([]byte(`[1, 2]`), &p); err == nil {
+		t.Error("an array was accepted as parameters")
+	}
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResultCode says what a JANE verification result code means
+type ResultCode struct {
+	Status      string `bson:"status" json:"status"`                               // one of the Status constants
+	Explanation string `bson:"explanation,omitempty" json:"explanation,omitempty"` // shown next to the rule's result
+	Severity    string `bson:"severity,omitempty" json:"severity,omitempty"`       // one of the Severity constants
+}
+
+// How serious a result code is
+const (
+	SeverityInfo     = "info"
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// ResultCodes is a catalogue of JANE verification result codes
+type ResultCodes map[int]ResultCode
+
+// Lookup returns what a result code means. Codes missing from the catalogue, or listed
+// without a status, pass if they are 0 and fail otherwise.
+func (c ResultCodes) Lookup(code int) ResultCode {
+	rc, ok := c[code]
+	if !ok && code != 0 {
+		rc.Explanation = fmt.Sprintf("unknown result code %d", code)
+	}
+	rc.Status = strings.ToLower(rc.Status)
+	if rc.Status == "" {
+		rc.Status = StatusFail
+		if code == 0 {
+			rc.Status = StatusPass
+		}
+	}
+	return rc
+}
+
+// Merge returns the catalogue with the entries of over laid on top.
+// Fields left empty in an entry of over keep the value from c.
+func (c ResultCodes) Merge(over ResultCodes) ResultCodes {
+	out := make(ResultCodes, len(c)+len(over))
+	for code, rc := range c {
+		out[code] = rc
+	}
+	for code, rc := range over {
+		base := out[code]
+		if rc.Status != "" {
+			base.Status = rc.Status
+		}
+		if rc.Explanation != "" {
+			base.Explanation = rc.Explanation
+		}
+		if rc.Severity != "" {
+			base.Severity = rc.Severity
+		}
+		out[code] = base
+	}
+	return out
+}
+
+// Check reports a status or severity that is not one of the known values.
+// An empty status is allowed so policies can override just the explanation or severity.
+func (rc ResultCode) Check() error {
+	switch strings.ToLower(rc.Status) {
+	case "", StatusPass, StatusFail, StatusError, StatusSkipped:
+	default:
+		return fmt.Errorf("status %q must be %s, %s, %s or %s", rc.Status, StatusPass, StatusFail, StatusError, StatusSkipped)
+	}
+	switch strings.ToLower(rc.Severity) {
+	case "", SeverityInfo, SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical:
+	default:
+		return fmt.Errorf("severity %q must be %s, %s, %s, %s or %s", rc.Severity,
+			SeverityInfo, SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical)
+	}
+	return nil
+}
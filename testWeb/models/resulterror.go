@@ -0,0 +1,21 @@
+package models
+
+// Kinds of ResultError
+const (
+	ErrorKindTimeout     = "timeout"      // JANE did not answer in time
+	ErrorKindNotFound    = "not_found"    // JANE does not know the element, intent, claim or result
+	ErrorKindJane        = "jane"         // JANE answered with an error
+	ErrorKindUnreachable = "unreachable"  // JANE could not be reached or its answer not read
+	ErrorKindCancelled   = "cancelled"    // the run was cancelled before JANE answered
+	ErrorKindCircuitOpen = "circuit_open" // JANE's circuit breaker was open, so it was not called
+)
+
+// ResultError says why an attestation ended with the error status, so the UI and API
+// can tell a timeout from a missing intent from an error reported by JANE
+type ResultError struct {
+	Kind     string `bson:"kind" json:"kind"` // one of the ErrorKind constants
+	Message  string `bson:"message" json:"message"`
+	Endpoint string `bson:"endpoint,omitempty" json:"endpoint,omitempty"`       // JANE API path that failed, e.g. "/attest"
+	Status   int    `bson:"http_status,omitempty" json:"http_status,omitempty"` // HTTP status of JANE's answer
+	Code     int    `bson:"code,omitempty" json:"code,omitempty"`               // JANE result code, if the answer carried one
+}
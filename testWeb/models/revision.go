@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Revision is an immutable copy of a policy as it was saved. Numbers count up from 1 per policy
+// name and are never reused, also not after the policy is deleted and created again.
+type Revision struct {
+	ID       string    `bson:"_id" json:"id"`
+	Policy   string    `bson:"policy" json:"policy"`
+	Number   int       `bson:"number" json:"number"`
+	Author   string    `bson:"author" json:"author"`
+	Time     time.Time `bson:"time" json:"time"`
+	Note     string    `bson:"note" json:"note"`
+	Document *Policy   `bson:"document,omitempty" json:"document,omitempty"` // left out of listings
+}
+
+// ChangedFields returns the JSON names of the top-level fields that differ between two policies.
+// Where a policy is managed and its revision number are bookkeeping and not compared.
+func ChangedFields(a, b *Policy) []string {
+	ma, mb := contentMap(a), contentMap(b)
+
+	keys := make(map[string]bool)
+	for k := range ma {
+		keys[k] = true
+	}
+	for k := range mb {
+		keys[k] = true
+	}
+	var fields []string
+	for k := range keys {
+		if !reflect.DeepEqual(ma[k], mb[k]) {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// contentMap turns a policy into its generic JSON form, so numbers decoded from BSON and from files compare equal
+func contentMap(p *Policy) map[string]interface{} {
+	raw, _ := json.Marshal(p)
+	var m map[string]interface{}
+	json.Unmarshal(raw, &m)
+	delete(m, "source")
+	delete(m, "revision")
+	return m
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Location returns the time zone the schedule is evaluated in
+func (s *Schedule) Location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+	return loc, nil
+}
+
+// JitterDuration returns the maximum random delay added to each run
+func (s *Schedule) JitterDuration() (time.Duration, error) {
+	if s.Jitter == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s.Jitter)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("jitter %q is not a positive duration", s.Jitter)
+	}
+	return d, nil
+}
+
+// Next returns the first fire time after t, including jitter
+func (s *Schedule) Next(t time.Time) (time.Time, error) {
+	sched, err := cron.ParseStandard(s.Cron)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid cron expression %q: %v", s.Cron, err)
+	}
+	loc, err := s.Location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	jitter, err := s.JitterDuration()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	next := sched.Next(t.In(loc))
+	if jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(jitter) + 1)))
+	}
+	return next, nil
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/robfig/cron/v3"
+)
+
+// FieldError describes one problem with one field of a document
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError holds every problem found while validating a document
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return "invalid policy: " + strings.Join(parts, "; ")
+}
+
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// policy names are used in URLs, so they are kept to a safe set of characters
+var policyNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Validate checks that a policy is complete enough to be stored and executed.
+// It returns a *ValidationError listing every problem, or nil.
+func (p *Policy) Validate() error {
+	v := &ValidationError{}
+
+	if strings.TrimSpace(p.Name) == "" {
+		v.add("name", "must not be empty")
+	} else if !policyNamePattern.MatchString(p.Name) {
+		v.add("name", "%q may only contain letters, digits, '.', '_' and '-'", p.Name)
+	}
+
+	if p.Jane != "" {
+		u, err := url.Parse(p.Jane)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add("jane", "%q is not an http(s) URL", p.Jane)
+		}
+	}
+
+	switch strings.ToLower(p.Collection.TagMatch) {
+	case "", TagMatchOr, TagMatchAnd:
+	default:
+		v.add("collection.tagmatch", "must be %q or %q", TagMatchOr, TagMatchAnd)
+	}
+	if len(p.Collection.Items)+len(p.Collection.Names)+len(p.Collection.Tags) == 0 {
+		v.add("collection", "must select at least one item, name or tag")
+	}
+	for i, s := range p.Collection.Items {
+		if strings.TrimSpace(s) == "" {
+			v.add(fmt.Sprintf("collection.items[%d]", i), "must not be empty")
+		}
+	}
+	for i, s := range p.Collection.Names {
+		if strings.TrimSpace(s) == "" {
+			v.add(fmt.Sprintf("collection.names[%d]", i), "must not be empty")
+		}
+	}
+	for i, s := range p.Collection.Tags {
+		if strings.TrimSpace(s) == "" {
+			v.add(fmt.Sprintf("collection.tags[%d]", i), "must not be empty")
+		}
+	}
+
+	if len(p.Attestations) == 0 {
+		v.add("attestations", "must contain at least one attestation")
+	}
+	for i, a := range p.Attestations {
+		field := fmt.Sprintf("attestations[%d]", i)
+		if strings.TrimSpace(a.Intent) == "" {
+			v.add(field+".intent", "must not be empty")
+		}
+		if strings.TrimSpace(a.Endpoint) == "" {
+			v.add(field+".endpoint", "must not be empty")
+		}
+		for j, r := range a.Rules {
+			if strings.TrimSpace(r.Name) == "" {
+				v.add(fmt.Sprintf("%s.rules[%d].name", field, j), "must not be empty")
+			}
+			switch r.EffectiveDecision() {
+			case DecisionRequired, DecisionAdvisory, DecisionIgnore, DecisionFailFast:
+			default:
+				v.add(fmt.Sprintf("%s.rules[%d].decision", field, j), "must be one of %q, %q, %q or %q",
+					DecisionRequired, DecisionAdvisory, DecisionIgnore, DecisionFailFast)
+			}
+		}
+	}
+
+	for code, rc := range p.ResultCodes {
+		if err := rc.Check(); err != nil {
+			v.add(fmt.Sprintf("resultcodes.%d", code), "%v", err)
+		}
+	}
+
+	if p.Schedule != nil {
+		if _, err := cron.ParseStandard(p.Schedule.Cron); err != nil {
+			v.add("schedule.cron", "%q is not a valid cron expression: %v", p.Schedule.Cron, err)
+		}
+		if _, err := p.Schedule.JitterDuration(); err != nil {
+			v.add("schedule.jitter", "%v", err)
+		}
+		if _, err := p.Schedule.Location(); err != nil {
+			v.add("schedule.timezone", "%v", err)
+		}
+	}
+
+	if len(v.Errors) > 0 {
+		return v
+	}
+	return nil
+}
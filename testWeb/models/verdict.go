@@ -0,0 +1,50 @@
+package models
+
+// Outcome of a rule, an attestation, an element or a whole policy run
+const (
+	StatusPass    = "pass"
+	StatusFail    = "fail"    // JANE answered and the element did not meet the policy
+	StatusError   = "error"   // the outcome could not be determined, e.g. JANE was unreachable
+	StatusSkipped = "skipped" // not run, e.g. after a fail-fast rule
+)
+
+// Rollup combines statuses into one: any fail makes a fail, otherwise any error an error,
+// otherwise any pass a pass. Only skipped statuses roll up to skipped, none to "".
+func Rollup(statuses ...string) string {
+	seen := make(map[string]bool, 4)
+	for _, s := range statuses {
+		seen[s] = true
+	}
+	switch {
+	case seen[StatusFail]:
+		return StatusFail
+	case seen[StatusError]:
+		return StatusError
+	case seen[StatusPass]:
+		return StatusPass
+	case seen[StatusSkipped]:
+		return StatusSkipped
+	}
+	return ""
+}
+
+// ElementVerdict is the rollup of every attestation of one element in a run
+type ElementVerdict struct {
+	ElementID    string `bson:"element_id" json:"element_id"`
+	ElementName  string `bson:"element_name,omitempty" json:"element_name,omitempty"`
+	Status       string `bson:"status" json:"status"`
+	Attestations int    `bson:"attestations" json:"attestations"`
+	Warnings     int    `bson:"warnings,omitempty" json:"warnings,omitempty"`
+}
+
+// EffectiveStatus returns the status of an attestation result.
+// Results recorded before statuses existed only have Passed.
+func (r AttestationResult) EffectiveStatus() string {
+	if r.Status != "" {
+		return r.Status
+	}
+	if r.Passed {
+		return StatusPass
+	}
+	return StatusFail
+}
@@ -0,0 +1,387 @@
+// Package policyfile reads policies from JSON and YAML files.
+//
+// A file holds one policy, a list of policies, or, for YAML, several documents separated
+// by "---", each holding a policy or a list. Both formats are decoded through the policy's
+// JSON field names, unknown fields are rejected and every problem is reported as file:line.
+package policyfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+
+	"janeauto/models"
+)
+
+// Document is one policy read from a file, with the line it starts on
+type Document struct {
+	Policy *models.Policy
+	File   string
+	Line   int
+}
+
+// Error is a problem at a line of a policy file
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// Errors collects every problem found while loading
+type Errors []*Error
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, err := range e {
+		parts[i] = err.Error()
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Extensions are the file extensions LoadDir picks up
+var Extensions = []string{".json", ".yaml", ".yml"}
+
+// LoadDir reads every policy file below dir, in path order. Policies that load cleanly are
+// returned even if others fail; the failures come back as Errors. A policy name used twice
+// is reported at its second use.
+func LoadDir(dir string) ([]Document, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && isPolicyFile(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var docs []Document
+	var errs Errors
+	seen := make(map[string]Document)
+	for _, file := range files {
+		fileDocs, err := LoadFile(file)
+		errs = appendErrors(errs, file, err)
+		for _, d := range fileDocs {
+			if first, ok := seen[d.Policy.Name]; ok {
+				errs = append(errs, &Error{File: d.File, Line: d.Line,
+					Msg: fmt.Sprintf("policy %q is already defined at %s:%d", d.Policy.Name, first.File, first.Line)})
+				continue
+			}
+			seen[d.Policy.Name] = d
+			docs = append(docs, d)
+		}
+	}
+	if len(errs) > 0 {
+		return docs, errs
+	}
+	return docs, nil
+}
+
+// LoadFile reads the policies of one file
+func LoadFile(path string) ([]Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, data)
+}
+
+// Parse reads the policies in data; name is used in positions and to tell JSON from YAML
+func Parse(name string, data []byte) ([]Document, error) {
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		if offset, err := checkJSON(data); err != nil {
+			return nil, Errors{{File: name, Line: lineAt(data, offset), Msg: err.Error()}}
+		}
+	}
+
+	var docs []Document
+	var errs Errors
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// the parser cannot recover, so nothing after this point is read
+			errs = append(errs, &Error{File: name, Line: yamlErrorLine(err), Msg: err.Error()})
+			break
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+
+		root := doc.Content[0]
+		switch {
+		case root.Kind == yaml.ScalarNode && root.Tag == "!!null":
+			continue
+		case root.Kind == yaml.SequenceNode:
+			for _, item := range root.Content {
+				d, err := decodePolicy(name, item)
+				if err != nil {
+					errs = append(errs, err...)
+					continue
+				}
+				docs = append(docs, d)
+			}
+		default:
+			d, err := decodePolicy(name, root)
+			if err != nil {
+				errs = append(errs, err...)
+				continue
+			}
+			docs = append(docs, d)
+		}
+	}
+	if len(errs) > 0 {
+		return docs, errs
+	}
+	return docs, nil
+}
+
+func isPolicyFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range Extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+func appendErrors(errs Errors, file string, err error) Errors {
+	if err == nil {
+		return errs
+	}
+	var list Errors
+	if errors.As(err, &list) {
+		return append(errs, list...)
+	}
+	return append(errs, &Error{File: file, Line: 1, Msg: err.Error()})
+}
+
+// decodePolicy strictly decodes one policy node and validates it
+func decodePolicy(file string, node *yaml.Node) (Document, Errors) {
+	at := func(line int, format string, args ...interface{}) Errors {
+		return Errors{{File: file, Line: line, Msg: fmt.Sprintf(format, args...)}}
+	}
+	if node.Kind != yaml.MappingNode {
+		return Document{}, at(node.Line, "expected a policy object")
+	}
+
+	var generic interface{}
+	if err := node.Decode(&generic); err != nil {
+		return Document{}, at(yamlErrorLine(err, node.Line), "%v", err)
+	}
+	raw, err := json.Marshal(jsonCompatible(generic))
+	if err != nil {
+		return Document{}, at(node.Line, "%v", err)
+	}
+
+	var policy models.Policy
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&policy); err != nil {
+		return Document{}, at(decodeErrorLine(node, err), "%s", strings.TrimPrefix(err.Error(), "json: "))
+	}
+
+	if err := policy.Validate(); err != nil {
+		var verr *models.ValidationError
+		if !errors.As(err, &verr) {
+			return Document{}, at(node.Line, "%v", err)
+		}
+		var errs Errors
+		for _, fe := range verr.Errors {
+			errs = append(errs, &Error{File: file, Line: fieldLine(node, fe.Field), Msg: fe.Field + ": " + fe.Message})
+		}
+		return Document{}, errs
+	}
+	return Document{Policy: &policy, File: file, Line: node.Line}, nil
+}
+
+// jsonCompatible turns the maps YAML produces for non-string keys, like result codes, into string-keyed maps
+func jsonCompatible(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = jsonCompatible(e)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = jsonCompatible(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonCompatible(e)
+		}
+		return v
+	}
+	return v
+}
+
+// checkJSON makes sure a .json file holds exactly one JSON value.
+// On failure it returns the offset of the problem.
+func checkJSON(data []byte) (int64, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			return syntax.Offset, err
+		}
+		return int64(len(data)), err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return dec.InputOffset(), errors.New("unexpected data after the first JSON value")
+	}
+	return 0, nil
+}
+
+// lineAt returns the 1-based line of a byte offset
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+var yamlLine = regexp.MustCompile(`line (\d+)`)
+
+// yamlErrorLine pulls the line number out of a YAML error, or returns fallback
+func yamlErrorLine(err error, fallback ...int) int {
+	if m := yamlLine.FindStringSubmatch(err.Error()); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return n
+	}
+	if len(fallback) > 0 {
+		return fallback[0]
+	}
+	return 1
+}
+
+var unknownField = regexp.MustCompile(`unknown field "([^"]+)"`)
+
+// decodeErrorLine finds the line of the field a JSON decoding error is about
+func decodeErrorLine(node *yaml.Node, err error) int {
+	if m := unknownField.FindStringSubmatch(err.Error()); m != nil {
+		if key := findKey(node, m[1]); key != nil {
+			return key.Line
+		}
+	}
+	var typ *json.UnmarshalTypeError
+	if errors.As(err, &typ) && typ.Field != "" {
+		if n := findPath(node, strings.Split(typ.Field, ".")); n != nil {
+			return n.Line
+		}
+	}
+	return node.Line
+}
+
+// findKey returns the first mapping key named key, depth first
+func findKey(node *yaml.Node, key string) *yaml.Node {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return node.Content[i]
+			}
+			if n := findKey(node.Content[i+1], key); n != nil {
+				return n
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if n := findKey(item, key); n != nil {
+				return n
+			}
+		}
+	}
+	return nil
+}
+
+// findPath follows mapping keys and list indexes; where a list has no index every item is tried
+func findPath(node *yaml.Node, keys []string) *yaml.Node {
+	if len(keys) == 0 {
+		return node
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if strings.EqualFold(node.Content[i].Value, keys[0]) {
+				if len(keys) == 1 {
+					return node.Content[i]
+				}
+				return findPath(node.Content[i+1], keys[1:])
+			}
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(keys[0]); err == nil {
+			if i < len(node.Content) {
+				return findPath(node.Content[i], keys[1:])
+			}
+			return nil
+		}
+		for _, item := range node.Content {
+			if n := findPath(item, keys); n != nil {
+				return n
+			}
+		}
+	}
+	return nil
+}
+
+var fieldSegment = regexp.MustCompile(`([^.\[\]]+)|\[(\d+)\]`)
+
+// fieldLine returns the line of a validation field such as "attestations[0].rules[1].name",
+// or of the deepest part of it that exists
+func fieldLine(node *yaml.Node, field string) int {
+	line := node.Line
+	cur := node
+	for _, m := range fieldSegment.FindAllStringSubmatch(field, -1) {
+		var next *yaml.Node
+		switch {
+		case m[2] != "" && cur.Kind == yaml.SequenceNode:
+			if i, _ := strconv.Atoi(m[2]); i < len(cur.Content) {
+				next = cur.Content[i]
+				line = next.Line
+			}
+		case m[1] != "" && cur.Kind == yaml.MappingNode:
+			for i := 0; i+1 < len(cur.Content); i += 2 {
+				if cur.Content[i].Value == m[1] {
+					line = cur.Content[i].Line
+					next = cur.Content[i+1]
+					break
+				}
+			}
+		}
+		if next == nil {
+			break
+		}
+		cur = next
+	}
+	return line
+}
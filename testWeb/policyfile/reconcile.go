@@ -0,0 +1,72 @@
+package policyfile
+
+import (
+	"sort"
+
+	"janeauto/models"
+)
+
+// What reconciling does with a policy
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionKeep   = "keep" // stored policy without a file that reconciling must not delete
+)
+
+// Change is one step that brings the stored policies in line with the directory
+type Change struct {
+	Action  string
+	Name    string
+	Doc     *Document      // the desired policy, nil for delete and for keep without a file
+	Current *models.Policy // the stored policy, nil for create
+	Fields  []string       // top-level fields that differ, for update
+	Reason  string         // why a policy is kept
+}
+
+// Diff compares the policies read from a directory with the stored ones. The directory wins:
+// missing policies are created, differing ones updated and stored policies without a file
+// deleted, unless they were created through the API or predate source tracking.
+// A file never takes over a policy created through the API, that policy is kept as it is.
+// Policies that are already equal produce no change.
+func Diff(desired []Document, current []models.Policy) []Change {
+	stored := make(map[string]*models.Policy, len(current))
+	for i := range current {
+		stored[current[i].Name] = &current[i]
+	}
+
+	var changes []Change
+	for i := range desired {
+		doc := &desired[i]
+		cur, ok := stored[doc.Policy.Name]
+		if !ok {
+			changes = append(changes, Change{Action: ActionCreate, Name: doc.Policy.Name, Doc: doc})
+			continue
+		}
+		delete(stored, doc.Policy.Name)
+		if cur.Source == models.SourceAPI {
+			changes = append(changes, Change{Action: ActionKeep, Name: doc.Policy.Name, Doc: doc, Current: cur, Reason: "created through the API, the file is ignored"})
+			continue
+		}
+		if fields := models.ChangedFields(doc.Policy, cur); len(fields) > 0 || cur.Source != models.SourceFile {
+			if cur.Source != models.SourceFile {
+				fields = append(fields, "source")
+			}
+			changes = append(changes, Change{Action: ActionUpdate, Name: doc.Policy.Name, Doc: doc, Current: cur, Fields: fields})
+		}
+	}
+
+	var rest []Change
+	for name, cur := range stored {
+		switch cur.Source {
+		case models.SourceFile:
+			rest = append(rest, Change{Action: ActionDelete, Name: name, Current: cur})
+		case models.SourceAPI:
+			rest = append(rest, Change{Action: ActionKeep, Name: name, Current: cur, Reason: "created through the API"})
+		default:
+			rest = append(rest, Change{Action: ActionKeep, Name: name, Current: cur, Reason: "not known to come from a file"})
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool { return rest[i].Name < rest[j].Name })
+	return append(changes, rest...)
+}
@@ -0,0 +1,43 @@
+package policyfile
+
+import (
+	"testing"
+
+	"janeauto/models"
+)
+
+func TestDiff(t *testing.T) {
+	doc := func(name, desc string) Document {
+		return Document{Policy: &models.Policy{Name: name, Description: desc}, File: "p.yaml", Line: 1}
+	}
+	desired := []Document{doc("new", ""), doc("changed", "b"), doc("same", ""), doc("legacy", ""), doc("api", "from file")}
+	current := []models.Policy{
+		{Name: "changed", Description: "a", Source: models.SourceFile},
+		{Name: "same", Source: models.SourceFile},
+		{Name: "legacy"},
+		{Name: "api", Description: "from api", Source: models.SourceAPI},
+		{Name: "gone", Source: models.SourceFile},
+		{Name: "api-only", Source: models.SourceAPI},
+	}
+
+	want := map[string]string{
+		"new":      ActionCreate,
+		"changed":  ActionUpdate,
+		"legacy":   ActionUpdate,
+		"api":      ActionKeep,
+		"gone":     ActionDelete,
+		"api-only": ActionKeep,
+	}
+	changes := Diff(desired, current)
+	if len(changes) != len(want) {
+		t.Errorf("got %d changes, want %d: %+v", len(changes), len(want), changes)
+	}
+	for _, c := range changes {
+		if c.Action != want[c.Name] {
+			t.Errorf("%s: got %s, want %s", c.Name, c.Action, want[c.Name])
+		}
+		if c.Name == "api" && (c.Doc == nil || c.Reason == "") {
+			t.Errorf("api: a file matching an API policy should be reported with a reason, got %+v", c)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Package provisioning turns JANE provisioning files into policies
+package provisioning
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+
+	"janeauto/models"
+)
+
+// file is the part of a provisioning file the importer reads; other sections are ignored
+type file struct {
+	AttestationServer string `yaml:"attestationserver"`
+	Element           struct {
+		Name        string   `yaml:"name"`
+		Description string   `yaml:"description"`
+		Tags        []string `yaml:"tags"`
+	} `yaml:"element"`
+	Attest []map[string]intentEntry `yaml:"attest"`
+	EVS    []map[string]intentEntry `yaml:"evs"`
+}
+
+// intentEntry is one intent of the attest or evs section
+type intentEntry struct {
+	Protocol string   `yaml:"protocol"`
+	Type     string   `yaml:"type"`
+	Rules    []string `yaml:"rules"`
+}
+
+// characters not allowed in a policy name, see models.Policy.Validate
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ToPolicy converts a provisioning file into a policy. The element's name and tags become the
+// collection, with the tags matched together so only elements carrying all of them are selected.
+// Every intent of the attest and evs sections becomes an attestation with the intent's protocol
+// as endpoint and its rules as required rules; an intent listed in both sections is taken once.
+// Intents that are commented out are not seen by the YAML parser and so are left out.
+// name names the policy; if empty the element name is used.
+func ToPolicy(data []byte, name string) (*models.Policy, error) {
+	var f file
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid provisioning file: %v", err)
+	}
+
+	if name == "" {
+		name = strings.Trim(unsafeName.ReplaceAllString(strings.TrimSpace(f.Element.Name), "-"), "-._")
+	}
+	policy := &models.Policy{
+		Name:        name,
+		Description: f.Element.Description,
+		Jane:        f.AttestationServer,
+	}
+
+	if f.Element.Name != "" {
+		policy.Collection.Names = []string{strings.TrimSpace(f.Element.Name)}
+	}
+	for _, tag := range f.Element.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			policy.Collection.Tags = append(policy.Collection.Tags, tag)
+		}
+	}
+	if len(policy.Collection.Tags) > 0 {
+		policy.Collection.TagMatch = models.TagMatchAnd
+	}
+
+	seen := make(map[string]bool)
+	for _, section := range [][]map[string]intentEntry{f.Attest, f.EVS} {
+		for _, item := range section {
+			intents := make([]string, 0, len(item))
+			for intent := range item {
+				intents = append(intents, intent)
+			}
+			sort.Strings(intents)
+
+			for _, intent := range intents {
+				entry := item[intent]
+				intent = strings.TrimSpace(intent)
+				key := intent + "@" + entry.Protocol
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+
+				a := models.AttestItem{Intent: intent, Endpoint: strings.TrimSpace(entry.Protocol), Rules: []models.Rule{}}
+				for _, r := range entry.Rules {
+					if r = strings.TrimSpace(r); r != "" {
+						a.Rules = append(a.Rules, models.Rule{Name: r})
+					}
+				}
+				policy.Attestations = append(policy.Attestations, a)
+			}
+		}
+	}
+
+	if err := policy.Validate(); err != nil {
+		return policy, err
+	}
+	return policy, nil
+}
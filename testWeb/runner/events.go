@@ -0,0 +1,145 @@
+package runner
+
+import (
+	"time"
+
+	"janeauto/attestor"
+	"janeauto/models"
+)
+
+// Event is one step of a run's progress. Seq numbers start at 1 and increase by one per run.
+type Event struct {
+	Seq  int         `json:"seq"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// Event types
+const (
+	EventStatus             = "status"              // Data is the models.Run
+	EventElementsResolved   = "elements_resolved"   // Data has element_ids and count
+	EventSessionCreated     = "session_created"     // Data has session_id
+	EventAttestationStarted = "attestation_started" // Data has element_id and intent
+	EventClaimFetched       = "claim_fetched"       // Data has element_id, intent and claim_id
+	EventRuleVerdict        = "rule_verdict"        // Data has element_id, intent, rule and status
+	EventResult             = "result"              // Data is the models.AttestationResult
+	EventDone               = "done"                // Data is the final models.Run
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind before it is dropped.
+// A dropped subscriber can resubscribe from the last Seq it saw.
+const subscriberBuffer = 256
+
+// publish records an event on the job and hands it to every subscriber
+func (j *job) publish(typ string, data interface{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.publishLocked(typ, data)
+}
+
+// publishLocked is publish for callers that already hold j.mu
+func (j *job) publishLocked(typ string, data interface{}) {
+	ev := Event{Seq: len(j.events) + 1, Type: typ, Time: time.Now(), Data: data}
+	j.events = append(j.events, ev)
+	for ch := range j.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(j.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// finishLocked publishes the final state of the run and ends every subscription.
+// The caller holds j.mu.
+func (j *job) finishLocked() {
+	j.publishLocked(EventDone, j.run)
+	j.finished = true
+	for ch := range j.subs {
+		delete(j.subs, ch)
+		close(ch)
+	}
+}
+
+// trace turns the attestor's progress hooks into events on the job
+func (j *job) trace() *attestor.RunTrace {
+	return &attestor.RunTrace{
+		ElementsResolved: func(ids []string) {
+			j.publish(EventElementsResolved, map[string]interface{}{"element_ids": ids, "count": len(ids)})
+		},
+		SessionCreated: func(sid string) {
+			j.mu.Lock()
+			defer j.mu.Unlock()
+			j.run.SessionID = sid
+			j.publishLocked(EventSessionCreated, map[string]interface{}{"session_id": sid})
+		},
+		AttestationStarted: func(eid, intent string) {
+			j.publish(EventAttestationStarted, map[string]interface{}{"element_id": eid, "intent": intent})
+		},
+		ClaimFetched: func(eid, intent, claimID string) {
+			j.publish(EventClaimFetched, map[string]interface{}{"element_id": eid, "intent": intent, "claim_id": claimID})
+		},
+		RuleVerdict: func(eid, intent, rule, status string) {
+			j.publish(EventRuleVerdict, map[string]interface{}{"element_id": eid, "intent": intent, "rule": rule, "status": status})
+		},
+		ResultReady: func(r models.AttestationResult) {
+			j.mu.Lock()
+			defer j.mu.Unlock()
+			j.results = append(j.results, r)
+			j.publishLocked(EventResult, r)
+		},
+	}
+}
+
+// Subscribe returns the events of a run after Seq after, and a channel carrying the events that follow.
+// The channel is closed when the run is over or the subscriber falls too far behind.
+// Call the returned function to stop listening. ok is false if the run is not held in memory.
+func (q *Queue) Subscribe(id string, after int) (history []Event, live <-chan Event, unsubscribe func(), ok bool) {
+	q.mu.Lock()
+	j, ok := q.jobs[id]
+	q.mu.Unlock()
+	if !ok {
+		return nil, nil, nil, false
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if after < 0 {
+		after = 0
+	}
+	if after < len(j.events) {
+		history = append(history, j.events[after:]...)
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	if j.finished {
+		// nothing more will happen
+		close(ch)
+		return history, ch, func() {}, true
+	}
+
+	if j.subs == nil {
+		j.subs = make(map[chan Event]struct{})
+	}
+	j.subs[ch] = struct{}{}
+	unsubscribe = func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if _, ok := j.subs[ch]; ok {
+			delete(j.subs, ch)
+			close(ch)
+		}
+	}
+	return history, ch, unsubscribe, true
+}
+
+// Subscribe follows a run on the server's queue, see Queue.Subscribe
+func Subscribe(id string, after int) ([]Event, <-chan Event, func(), bool) {
+	if defaultQueue == nil {
+		return nil, nil, nil, false
+	}
+	return defaultQueue.Subscribe(id, after)
+}
@@ -0,0 +1,382 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"janeauto/attestor"
+	"janeauto/db"
+	"janeauto/jane"
+	"janeauto/models"
+)
+
+var (
+	// ErrQueueFull is returned by Submit when no more runs can be queued
+	ErrQueueFull = errors.New("run queue is full")
+	// ErrNotRunning is returned by Cancel for runs that have already finished
+	ErrNotRunning = errors.New("run has already finished")
+	// ErrNotStarted is returned when the queue is used before Start
+	ErrNotStarted = errors.New("run queue has not been started")
+)
+
+// job is a queued or running policy run together with the results produced so far
+type job struct {
+	mu      sync.Mutex
+	run     models.Run
+	policy  *models.Policy
+	results []models.AttestationResult
+
+	// progress events, see events.go
+	events   []Event
+	subs     map[chan Event]struct{}
+	finished bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (j *job) snapshot() (models.Run, []models.AttestationResult) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	results := make([]models.AttestationResult, len(j.results))
+	copy(results, j.results)
+	return j.run, results
+}
+
+// Queue runs submitted policies in the background on a fixed number of workers.
+// Finished runs stay in memory for the retention period and are read from the database afterwards.
+type Queue struct {
+	mu        sync.Mutex
+	jobs      map[string]*job
+	pending   chan *job
+	retention time.Duration
+	recordDir string // where cassettes of the runs are written, empty for none
+	reserved  int    // slots taken by runs that Submit is still recording
+}
+
+// NewQueue builds a queue that holds up to size waiting runs
+func NewQueue(size int, retention time.Duration) *Queue {
+	if size < 1 {
+		size = 1
+	}
+	return &Queue{
+		jobs:      make(map[string]*job),
+		pending:   make(chan *job, size),
+		retention: retention,
+	}
+}
+
+// Start launches the workers. Each worker runs one policy at a time.
+func (q *Queue) Start(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+}
+
+// RecordTo makes the queue write the JANE traffic of every run to dir/<run id>.json for replay
+func (q *Queue) RecordTo(dir string) {
+	q.mu.Lock()
+	q.recordDir = dir
+	q.mu.Unlock()
+}
+
+// Submit records a new run of policy as queued and returns it straight away.
+// triggeredBy says who started the run, e.g. "web:10.0.0.5".
+func (q *Queue) Submit(policy *models.Policy, triggeredBy string) (*models.Run, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		run: models.Run{
+			ID:          db.NewRunID(),
+			PolicyName:  policy.Name,
+			Policy:      *policy,
+			Revision:    policy.Revision,
+			JaneURL:     attestor.JaneURL(policy),
+			TriggeredBy: triggeredBy,
+			Status:      models.RunQueued,
+			QueuedAt:    time.Now(),
+		},
+		policy: policy,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	// the slot is reserved under q.mu but the run is recorded without it, so a slow
+	// database does not hold up the other users of the queue
+	q.mu.Lock()
+	q.prune()
+	if len(q.pending)+q.reserved >= cap(q.pending) {
+		q.mu.Unlock()
+		cancel()
+		return nil, ErrQueueFull
+	}
+	q.reserved++
+	q.mu.Unlock()
+
+	run := j.run
+	if err := db.InsertRun(&run); err != nil {
+		fmt.Printf("[WARNING] Could not record queued run %s: %v\n", run.ID, err)
+	}
+
+	// only Submit sends on pending, so the reserved slot is still free
+	q.mu.Lock()
+	q.reserved--
+	q.jobs[run.ID] = j
+	q.pending <- j
+	q.mu.Unlock()
+	return &run, nil
+}
+
+// Get returns the current state and the results so far of a run held in memory
+func (q *Queue) Get(id string) (models.Run, []models.AttestationResult, bool) {
+	q.mu.Lock()
+	j, ok := q.jobs[id]
+	q.mu.Unlock()
+	if !ok {
+		return models.Run{}, nil, false
+	}
+	run, results := j.snapshot()
+	return run, results, true
+}
+
+// Active reports whether a run of the named policy is queued or running
+func (q *Queue) Active(policyName string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, j := range q.jobs {
+		j.mu.Lock()
+		active := j.run.PolicyName == policyName && !j.finished
+		j.mu.Unlock()
+		if active {
+			return true
+		}
+	}
+	return false
+}
+
+// Done returns a channel that is closed when the run has finished, or nil for unknown runs
+func (q *Queue) Done(id string) <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if j, ok := q.jobs[id]; ok {
+		return j.done
+	}
+	return nil
+}
+
+// Cancel stops a queued or running run. A running run's attestor context is cancelled,
+// so its outstanding JANE calls are aborted.
+func (q *Queue) Cancel(id string) error {
+	q.mu.Lock()
+	j, ok := q.jobs[id]
+	q.mu.Unlock()
+	if !ok {
+		return db.ErrNotFound
+	}
+
+	select {
+	case <-j.done:
+		return ErrNotRunning
+	default:
+	}
+
+	// a run that has not started yet is cancelled right away; a worker will skip it
+	j.mu.Lock()
+	queued := j.run.Status == models.RunQueued
+	if queued {
+		j.run.Status = models.RunCancelled
+		j.run.FinishedAt = time.Now()
+		j.finishLocked()
+	}
+	run := j.run
+	j.mu.Unlock()
+
+	j.cancel()
+	if queued {
+		if err := db.FinishRun(&run, nil); err != nil {
+			fmt.Printf("[WARNING] Could not record run %s: %v\n", run.ID, err)
+		}
+	}
+	return nil
+}
+
+// prune drops finished runs older than the retention period. The caller holds q.mu.
+func (q *Queue) prune() {
+	cutoff := time.Now().Add(-q.retention)
+	for id, j := range q.jobs {
+		select {
+		case <-j.done:
+		default:
+			continue
+		}
+		j.mu.Lock()
+		old := j.run.FinishedAt.Before(cutoff)
+		j.mu.Unlock()
+		if old {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+func (q *Queue) worker() {
+	for j := range q.pending {
+		q.execute(j)
+	}
+}
+
+// execute runs one job and records its progress and outcome
+func (q *Queue) execute(j *job) {
+	defer close(j.done)
+	defer j.cancel()
+
+	j.mu.Lock()
+	if j.run.Status == models.RunCancelled {
+		// cancelled while still queued, Cancel has recorded it already
+		j.mu.Unlock()
+		return
+	}
+	j.run.Status = models.RunRunning
+	j.run.StartedAt = time.Now()
+	j.publishLocked(EventStatus, j.run)
+	run := j.run
+	j.mu.Unlock()
+	if err := db.UpdateRun(&run); err != nil {
+		fmt.Printf("[WARNING] Could not record start of run %s: %v\n", run.ID, err)
+	}
+
+	ctx := attestor.WithRunTrace(j.ctx, j.trace())
+	q.mu.Lock()
+	recordDir := q.recordDir
+	q.mu.Unlock()
+	var cassette *jane.Cassette
+	if recordDir != "" {
+		cassette = &jane.Cassette{RunID: run.ID}
+		ctx = jane.WithRecorder(ctx, cassette)
+	}
+	results, sessionID, err := executePolicy(ctx, j.policy)
+
+	j.mu.Lock()
+	j.results = results
+	j.run.SessionID = sessionID
+	j.run.FinishedAt = time.Now()
+	j.run.Verdict = attestor.Verdict(results, err)
+	j.run.Warnings = attestor.WarningCount(results)
+	j.run.Elements = attestor.ElementVerdicts(results)
+	switch {
+	case err != nil && j.ctx.Err() != nil:
+		j.run.Status = models.RunCancelled
+		j.run.Error = err.Error()
+	case errors.Is(err, jane.ErrCircuitOpen):
+		j.run.Status = models.RunJaneDown
+		j.run.Error = err.Error()
+	case err != nil:
+		j.run.Status = models.RunFailed
+		j.run.Error = err.Error()
+	default:
+		j.run.Status = models.RunSucceeded
+	}
+	j.run.ResultCount = len(results)
+	j.finishLocked()
+	run = j.run
+	j.mu.Unlock()
+
+	if err := db.FinishRun(&run, results); err != nil {
+		fmt.Printf("[WARNING] Could not record run %s: %v\n", run.ID, err)
+	}
+	if cassette != nil {
+		cassette.SetPolicy(j.policy)
+		cassette.Verdict = run.Verdict
+		if err := cassette.Save(filepath.Join(recordDir, run.ID+".json")); err != nil {
+			fmt.Printf("[WARNING] Could not write cassette of run %s: %v\n", run.ID, err)
+		}
+	}
+}
+
+// executePolicy runs the policy and turns a panic into an error, so one bad run
+// is marked failed instead of taking the server down
+func executePolicy(ctx context.Context, policy *models.Policy) (results []models.AttestationResult, sessionID string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("[ERROR] Run of policy %s panicked: %v\n%s", policy.Name, r, debug.Stack())
+			err = fmt.Errorf("internal error: %v", r)
+		}
+	}()
+	return attestor.ExecutePolicy(ctx, policy)
+}
+
+// the queue used by the server, set up by Start
+var defaultQueue *Queue
+
+// Start sets up the server's run queue with the given number of workers and waiting slots
+func Start(workers, size int, retention time.Duration) {
+	defaultQueue = NewQueue(size, retention)
+	defaultQueue.Start(workers)
+}
+
+// RecordTo makes the server's queue write a cassette of every run to dir, see Queue.RecordTo
+func RecordTo(dir string) {
+	if defaultQueue != nil {
+		defaultQueue.RecordTo(dir)
+	}
+}
+
+// Submit queues a run of policy on the server's queue
+func Submit(policy *models.Policy, triggeredBy string) (*models.Run, error) {
+	if defaultQueue == nil {
+		return nil, ErrNotStarted
+	}
+	return defaultQueue.Submit(policy, triggeredBy)
+}
+
+// Active reports whether a run of the named policy is queued or running on the server's queue
+func Active(policyName string) bool {
+	if defaultQueue == nil {
+		return false
+	}
+	return defaultQueue.Active(policyName)
+}
+
+// Cancel stops a queued or running run on the server's queue
+func Cancel(id string) error {
+	if defaultQueue == nil {
+		return ErrNotStarted
+	}
+	return defaultQueue.Cancel(id)
+}
+
+// Done returns a channel that is closed when the run has finished, or nil if the run is not in memory
+func Done(id string) <-chan struct{} {
+	if defaultQueue == nil {
+		return nil
+	}
+	return defaultQueue.Done(id)
+}
+
+// Lookup returns a run and its results, live from the queue while the run is in memory
+// and from the database afterwards. It returns db.ErrNotFound for unknown runs.
+func Lookup(id string) (*models.Run, []models.AttestationResult, error) {
+	if defaultQueue != nil {
+		if run, results, ok := defaultQueue.Get(id); ok {
+			return &run, results, nil
+		}
+	}
+
+	run, err := db.GetRun(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	results, err := db.GetRunResults(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return run, results, nil
+}
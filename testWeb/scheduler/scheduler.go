@@ -0,0 +1,289 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"janeauto/db"
+	"janeauto/models"
+)
+
+// TriggeredBy is recorded on every run the scheduler starts
+const TriggeredBy = "scheduler"
+
+// Entry is the schedule of one policy together with its fire times
+type Entry struct {
+	Policy    string    `json:"policy"`
+	Cron      string    `json:"cron"`
+	Timezone  string    `json:"timezone,omitempty"`
+	Jitter    string    `json:"jitter,omitempty"`
+	Next      time.Time `json:"next"`
+	Last      time.Time `json:"last,omitempty"`
+	LastRunID string    `json:"last_run_id,omitempty"`
+	// LastSkipped is set when the last fire was skipped because the previous run was still going
+	LastSkipped bool   `json:"last_skipped,omitempty"`
+	Error       string `json:"error,omitempty"`
+
+	policy models.Policy
+}
+
+// SubmitFunc queues a run of a policy, see runner.Submit
+type SubmitFunc func(policy *models.Policy, triggeredBy string) (*models.Run, error)
+
+// ActiveFunc reports whether a run of the named policy is queued or running, see runner.Active
+type ActiveFunc func(policyName string) bool
+
+// Scheduler starts runs of every policy that has a Schedule.
+// It rereads the policies every reload interval and whenever Reload is called.
+type Scheduler struct {
+	mu      sync.Mutex
+	entries map[string]*Entry
+
+	submit   SubmitFunc
+	active   ActiveFunc
+	interval time.Duration
+	reload   chan struct{}
+	stop     chan struct{}
+}
+
+// New builds a scheduler that queues runs with submit and skips policies for which active is true
+func New(submit SubmitFunc, active ActiveFunc, reloadInterval time.Duration) *Scheduler {
+	if reloadInterval <= 0 {
+		reloadInterval = time.Minute
+	}
+	return &Scheduler{
+		entries:  make(map[string]*Entry),
+		submit:   submit,
+		active:   active,
+		interval: reloadInterval,
+		reload:   make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start runs the scheduler loop in the background until Stop is called
+func (s *Scheduler) Start() {
+	go s.loop()
+}
+
+// Stop ends the scheduler loop. Runs already queued are not affected.
+func (s *Scheduler) Stop() {
+	close(s.stop)
+}
+
+// Reload makes the scheduler reread the policies, e.g. after one was changed
+func (s *Scheduler) Reload() {
+	select {
+	case s.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Entries returns every scheduled policy ordered by its next fire time
+func (s *Scheduler) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Next.Equal(out[j].Next) {
+			return out[i].Policy < out[j].Policy
+		}
+		return out[i].Next.Before(out[j].Next)
+	})
+	return out
+}
+
+// Entry returns the schedule of one policy
+func (s *Scheduler) Entry(policyName string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[policyName]
+	if !ok {
+		return Entry{}, false
+	}
+	return *e, true
+}
+
+func (s *Scheduler) loop() {
+	s.load(time.Now())
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		timer := time.NewTimer(s.untilNext(time.Now()))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-s.reload:
+			s.load(time.Now())
+		case <-ticker.C:
+			s.load(time.Now())
+		case now := <-timer.C:
+			s.fireDue(now)
+		}
+		timer.Stop()
+	}
+}
+
+// untilNext returns how long to sleep until the earliest fire time, capped at the reload interval
+func (s *Scheduler) untilNext(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wait := s.interval
+	for _, e := range s.entries {
+		if e.Next.IsZero() {
+			continue
+		}
+		if d := e.Next.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// load rebuilds the entries from the policies in the database, keeping the fire times
+// of policies whose schedule did not change
+func (s *Scheduler) load(now time.Time) {
+	policies, err := db.GetAllPolicies()
+	if err != nil {
+		fmt.Printf("[WARNING] Scheduler could not load policies: %v\n", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make(map[string]*Entry)
+	for _, p := range policies {
+		if p.Schedule == nil || p.Schedule.Cron == "" {
+			continue
+		}
+		e := &Entry{
+			Policy:   p.Name,
+			Cron:     p.Schedule.Cron,
+			Timezone: p.Schedule.Timezone,
+			Jitter:   p.Schedule.Jitter,
+			policy:   p,
+		}
+		if old, ok := s.entries[p.Name]; ok {
+			e.Last, e.LastRunID, e.LastSkipped = old.Last, old.LastRunID, old.LastSkipped
+			if old.Cron == e.Cron && old.Timezone == e.Timezone && old.Jitter == e.Jitter {
+				e.Next = old.Next
+			}
+		} else {
+			s.restoreLast(e)
+		}
+		if e.Next.IsZero() {
+			next, err := p.Schedule.Next(now)
+			if err != nil {
+				e.Error = err.Error()
+			}
+			e.Next = next
+		}
+		entries[p.Name] = e
+	}
+	s.entries = entries
+}
+
+// restoreLast fills in the last fire time from the run history so it survives restarts
+func (s *Scheduler) restoreLast(e *Entry) {
+	runs, _, err := db.ListRuns(db.RunFilter{Policy: e.Policy, TriggeredBy: TriggeredBy}, 1, 1)
+	if err != nil || len(runs) == 0 {
+		return
+	}
+	e.Last = runs[0].QueuedAt
+	e.LastRunID = runs[0].ID
+}
+
+// fireDue starts every policy whose fire time has come
+func (s *Scheduler) fireDue(now time.Time) {
+	s.mu.Lock()
+	var due []*Entry
+	for _, e := range s.entries {
+		if !e.Next.IsZero() && !e.Next.After(now) {
+			due = append(due, e)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, e := range due {
+		s.fire(e, now)
+	}
+}
+
+func (s *Scheduler) fire(e *Entry, now time.Time) {
+	s.mu.Lock()
+	policy := e.policy
+	s.mu.Unlock()
+
+	skipped := s.active != nil && s.active(policy.Name)
+	var runID, errMsg string
+	if skipped {
+		fmt.Printf("[SCHEDULER] Skipping '%s': previous run is still going\n", policy.Name)
+	} else {
+		run, err := s.submit(&policy, TriggeredBy)
+		if err != nil {
+			fmt.Printf("[SCHEDULER] Could not queue '%s': %v\n", policy.Name, err)
+			errMsg = err.Error()
+		} else {
+			fmt.Printf("[SCHEDULER] Queued run %s of '%s'\n", run.ID, policy.Name)
+			runID = run.ID
+		}
+	}
+
+	next, err := policy.Schedule.Next(now)
+	if err != nil {
+		errMsg = err.Error()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.Last = now
+	e.LastSkipped = skipped
+	if runID != "" {
+		e.LastRunID = runID
+	}
+	e.Error = errMsg
+	e.Next = next
+}
+
+// the scheduler used by the server, set up by Start
+var defaultScheduler *Scheduler
+
+// Start sets up and starts the server's scheduler
+func Start(submit SubmitFunc, active ActiveFunc, reloadInterval time.Duration) {
+	defaultScheduler = New(submit, active, reloadInterval)
+	defaultScheduler.Start()
+}
+
+// Reload makes the server's scheduler reread the policies
+func Reload() {
+	if defaultScheduler != nil {
+		defaultScheduler.Reload()
+	}
+}
+
+// Entries returns the server's scheduled policies, or nil if the scheduler is not running
+func Entries() []Entry {
+	if defaultScheduler == nil {
+		return nil
+	}
+	return defaultScheduler.Entries()
+}
+
+// Lookup returns the server's schedule of one policy
+func Lookup(policyName string) (Entry, bool) {
+	if defaultScheduler == nil {
+		return Entry{}, false
+	}
+	return defaultScheduler.Entry(policyName)
+}
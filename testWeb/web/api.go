@@ -0,0 +1,248 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"janeauto/db"
+	"janeauto/models"
+	"janeauto/scheduler"
+)
+
+// APIError is the body of every error response of the JSON API
+type APIError struct {
+	Error   string              `json:"error"`
+	Details []models.FieldError `json:"details,omitempty"`
+}
+
+func apiError(c echo.Context, status int, msg string, details ...models.FieldError) error {
+	return c.JSON(status, APIError{Error: msg, Details: details})
+}
+
+// apiFailure is an error echo's error handler sends back as an APIError body.
+// Helpers that return a value and an error use it instead of writing the response themselves.
+func apiFailure(status int, msg string, details ...models.FieldError) error {
+	return echo.NewHTTPError(status, APIError{Error: msg, Details: details})
+}
+
+// apiStoreError maps db errors onto HTTP statuses
+func apiStoreError(err error, name string) error {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return apiFailure(http.StatusNotFound, fmt.Sprintf("policy '%s' not found", name))
+	case errors.Is(err, db.ErrDuplicate):
+		return apiFailure(http.StatusConflict, fmt.Sprintf("policy '%s' already exists", name))
+	default:
+		return apiFailure(http.StatusInternalServerError, err.Error())
+	}
+}
+
+// decodePolicy reads a policy from the request body, rejecting unknown fields, and validates it
+func decodePolicy(body []byte) (*models.Policy, error) {
+	var policy models.Policy
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&policy); err != nil {
+		return nil, apiFailure(http.StatusBadRequest, "invalid JSON: "+err.Error())
+	}
+	if err := policy.Validate(); err != nil {
+		var verr *models.ValidationError
+		if errors.As(err, &verr) {
+			return nil, apiFailure(http.StatusUnprocessableEntity, "policy validation failed", verr.Errors...)
+		}
+		return nil, apiFailure(http.StatusUnprocessableEntity, err.Error())
+	}
+	return &policy, nil
+}
+
+// changeInfo returns who made a change and why, from the X-Author and X-Change-Note headers
+// or the form fields author and note, falling back to the given defaults
+func changeInfo(c echo.Context, author, note string) (string, string) {
+	if v := c.Request().Header.Get("X-Author"); v != "" {
+		author = v
+	} else if v := c.FormValue("author"); v != "" {
+		author = v
+	}
+	if v := c.Request().Header.Get("X-Change-Note"); v != "" {
+		note = v
+	} else if v := c.FormValue("note"); v != "" {
+		note = v
+	}
+	return author, note
+}
+
+func readBody(c echo.Context) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, 1<<20))
+	if err != nil {
+		return nil, apiFailure(http.StatusBadRequest, "failed to read body: "+err.Error())
+	}
+	return body, nil
+}
+
+// GET /api/v1/policies
+func APIListPoliciesHandler(c echo.Context) error {
+	policies, err := db.GetAllPolicies()
+	if err != nil {
+		return apiError(c, http.StatusInternalServerError, err.Error())
+	}
+	if policies == nil {
+		policies = []models.Policy{}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"policies": policies,
+		"count":    len(policies),
+	})
+}
+
+// GET /api/v1/policies/:name
+func APIGetPolicyHandler(c echo.Context) error {
+	name := c.Param("name")
+	policy, err := db.GetPolicyByName(name)
+	if err != nil {
+		return apiStoreError(err, name)
+	}
+	return c.JSON(http.StatusOK, policy)
+}
+
+// POST /api/v1/policies
+func APICreatePolicyHandler(c echo.Context) error {
+	body, err := readBody(c)
+	if err != nil {
+		return err
+	}
+	policy, err := decodePolicy(body)
+	if err != nil {
+		return err
+	}
+	policy.Source = models.SourceAPI
+
+	author, note := changeInfo(c, "api", "created through the API")
+	if err := db.CreatePolicy(policy, author, note); err != nil {
+		return apiStoreError(err, policy.Name)
+	}
+	scheduler.Reload()
+	c.Response().Header().Set(echo.HeaderLocation, "/api/v1/policies/"+policy.Name)
+	return c.JSON(http.StatusCreated, policy)
+}
+
+// PUT /api/v1/policies/:name replaces the whole policy.
+// The name in the body may be left out; if given it must match the URL.
+func APIUpdatePolicyHandler(c echo.Context) error {
+	name := c.Param("name")
+	body, err := readBody(c)
+	if err != nil {
+		return err
+	}
+
+	// fills in the name from the URL before validating
+	var probe map[string]interface{}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return apiFailure(http.StatusBadRequest, "invalid JSON: "+err.Error())
+	}
+	if probe == nil {
+		return apiFailure(http.StatusBadRequest, "policy must be a JSON object")
+	}
+	if n, ok := probe["name"]; !ok || n == "" {
+		probe["name"] = name
+		body, _ = json.Marshal(probe)
+	}
+
+	policy, err := decodePolicy(body)
+	if err != nil {
+		return err
+	}
+	if policy.Name != name {
+		return apiFailure(http.StatusBadRequest, "policy name in body does not match URL",
+			models.FieldError{Field: "name", Message: fmt.Sprintf("expected %q", name)})
+	}
+
+	// a policy stays managed where it was created
+	current, err := db.GetPolicyByName(name)
+	if err != nil {
+		return apiStoreError(err, name)
+	}
+	policy.Source = current.Source
+
+	author, note := changeInfo(c, "api", "replaced through the API")
+	if err := db.ReplacePolicy(name, policy, author, note); err != nil {
+		return apiStoreError(err, name)
+	}
+	scheduler.Reload()
+	return c.JSON(http.StatusOK, policy)
+}
+
+// PATCH /api/v1/policies/:name applies a JSON merge patch (RFC 7386) to the policy.
+// Renaming through a patch is allowed as long as the new name is free.
+func APIPatchPolicyHandler(c echo.Context) error {
+	name := c.Param("name")
+	body, err := readBody(c)
+	if err != nil {
+		return err
+	}
+
+	var patch interface{}
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return apiError(c, http.StatusBadRequest, "invalid JSON: "+err.Error())
+	}
+	if _, ok := patch.(map[string]interface{}); !ok {
+		return apiError(c, http.StatusBadRequest, "patch must be a JSON object")
+	}
+
+	current, err := db.GetPolicyByName(name)
+	if err != nil {
+		return apiStoreError(err, name)
+	}
+	currentJSON, _ := json.Marshal(current)
+	var doc interface{}
+	json.Unmarshal(currentJSON, &doc)
+
+	merged, _ := json.Marshal(mergePatch(doc, patch))
+	policy, err := decodePolicy(merged)
+	if err != nil {
+		return err
+	}
+	policy.Source = current.Source
+
+	author, note := changeInfo(c, "api", "patched through the API")
+	if err := db.ReplacePolicy(name, policy, author, note); err != nil {
+		return apiStoreError(err, policy.Name)
+	}
+	scheduler.Reload()
+	return c.JSON(http.StatusOK, policy)
+}
+
+// DELETE /api/v1/policies/:name
+func APIDeletePolicyHandler(c echo.Context) error {
+	name := c.Param("name")
+	if err := db.DeletePolicy(name); err != nil {
+		return apiStoreError(err, name)
+	}
+	scheduler.Reload()
+	return c.NoContent(http.StatusNoContent)
+}
+
+// mergePatch applies an RFC 7386 JSON merge patch to target and returns the result
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
@@ -0,0 +1,108 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"janeauto/db"
+	"janeauto/models"
+	"janeauto/runner"
+)
+
+// POST /api/v1/runs queues a run of the policy named in the body and returns its ID straight away
+func APISubmitRunHandler(c echo.Context) error {
+	var req struct {
+		Policy string `json:"policy"`
+	}
+	if err := c.Bind(&req); err != nil || req.Policy == "" {
+		return apiError(c, http.StatusBadRequest, "body must name a policy",
+			models.FieldError{Field: "policy", Message: "must not be empty"})
+	}
+
+	policy, err := db.GetPolicyByName(req.Policy)
+	if err != nil {
+		return apiStoreError(err, req.Policy)
+	}
+
+	run, err := runner.Submit(policy, "api:"+c.RealIP())
+	if errors.Is(err, runner.ErrQueueFull) {
+		return apiError(c, http.StatusServiceUnavailable, err.Error())
+	}
+	if err != nil {
+		return apiError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, "/api/v1/runs/"+run.ID)
+	return c.JSON(http.StatusAccepted, run)
+}
+
+// GET /api/v1/runs lists runs newest first. Query parameters: policy, status, page, page_size.
+func APIListRunsHandler(c echo.Context) error {
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	pageSize, _ := strconv.Atoi(c.QueryParam("page_size"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 200 {
+		pageSize = 20
+	}
+
+	filter := db.RunFilter{
+		Policy: c.QueryParam("policy"),
+		Status: c.QueryParam("status"),
+	}
+	runs, total, err := db.ListRuns(filter, page, pageSize)
+	if err != nil {
+		return apiError(c, http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"runs":      runs,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// GET /api/v1/runs/:id returns the run's status and its results so far
+func APIGetRunHandler(c echo.Context) error {
+	id := c.Param("id")
+	run, results, err := runner.Lookup(id)
+	if errors.Is(err, db.ErrNotFound) {
+		return apiError(c, http.StatusNotFound, fmt.Sprintf("run '%s' not found", id))
+	}
+	if err != nil {
+		return apiError(c, http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"run":     run,
+		"results": results,
+	})
+}
+
+// DELETE /api/v1/runs/:id cancels a queued or running run
+func APICancelRunHandler(c echo.Context) error {
+	id := c.Param("id")
+	err := runner.Cancel(id)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		// the run may be finished and no longer held in memory
+		if _, dbErr := db.GetRun(id); dbErr == nil {
+			return apiError(c, http.StatusConflict, runner.ErrNotRunning.Error())
+		}
+		return apiError(c, http.StatusNotFound, fmt.Sprintf("run '%s' not found", id))
+	case errors.Is(err, runner.ErrNotRunning):
+		return apiError(c, http.StatusConflict, err.Error())
+	case err != nil:
+		return apiError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	run, results, _ := runner.Lookup(id)
+	return c.JSON(http.StatusAccepted, map[string]interface{}{
+		"run":     run,
+		"results": results,
+	})
+}
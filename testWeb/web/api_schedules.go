@@ -0,0 +1,31 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"janeauto/scheduler"
+)
+
+// GET /api/v1/schedules lists every scheduled policy with its next and last fire times
+func APIListSchedulesHandler(c echo.Context) error {
+	entries := scheduler.Entries()
+	if entries == nil {
+		entries = []scheduler.Entry{}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"schedules": entries,
+		"count":     len(entries),
+	})
+}
+
+// GET /api/v1/schedules/:name returns the schedule of one policy
+func APIGetScheduleHandler(c echo.Context) error {
+	name := c.Param("name")
+	entry, ok := scheduler.Lookup(name)
+	if !ok {
+		return apiError(c, http.StatusNotFound, "policy '"+name+"' is not scheduled")
+	}
+	return c.JSON(http.StatusOK, entry)
+}
@@ -0,0 +1,161 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"janeauto/models"
+	"janeauto/runner"
+)
+
+// how often an idle event stream sends a comment to keep proxies from closing it
+const sseHeartbeat = 15 * time.Second
+
+// Streams the progress of a run as Server-Sent Events.
+// Reconnecting clients resume after the Last-Event-ID header, or the "after" query parameter.
+func RunEventsHandler(c echo.Context) error {
+	id := c.Param("id")
+	after, _ := strconv.Atoi(c.Request().Header.Get("Last-Event-ID"))
+	if q := c.QueryParam("after"); q != "" {
+		after, _ = strconv.Atoi(q)
+	}
+
+	history, live, unsubscribe, ok := runner.Subscribe(id, after)
+	if !ok {
+		// the run is no longer in memory, all there is to tell is how it ended
+		run, _, err := runner.Lookup(id)
+		if err != nil {
+			return c.String(http.StatusNotFound, "Run not found")
+		}
+		startSSE(c)
+		return writeSSE(c, runner.Event{Type: runner.EventDone, Time: run.FinishedAt, Data: run})
+	}
+	defer unsubscribe()
+
+	startSSE(c)
+	for _, ev := range history {
+		if err := writeSSE(c, ev); err != nil {
+			return nil
+		}
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case ev, open := <-live:
+			if !open {
+				return nil
+			}
+			if err := writeSSE(c, ev); err != nil {
+				return nil
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Response(), ": ping\n\n"); err != nil {
+				return nil
+			}
+			c.Response().Flush()
+		case <-c.Request().Context().Done():
+			return nil
+		}
+	}
+}
+
+func startSSE(c echo.Context) {
+	h := c.Response().Header()
+	h.Set(echo.HeaderContentType, "text/event-stream")
+	h.Set(echo.HeaderCacheControl, "no-cache")
+	h.Set(echo.HeaderConnection, "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	c.Response().WriteHeader(http.StatusOK)
+	c.Response().Flush()
+}
+
+// writeSSE sends one event. Result events carry the rendered card so the page does not need to build it.
+func writeSSE(c echo.Context, ev runner.Event) error {
+	data := ev.Data
+	if r, ok := ev.Data.(models.AttestationResult); ok {
+		data = map[string]interface{}{
+			"result": r,
+			"html":   renderResultCard(r),
+		}
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"seq":  ev.Seq,
+		"type": ev.Type,
+		"time": ev.Time,
+		"data": data,
+	})
+	if err != nil {
+		return err
+	}
+
+	w := c.Response()
+	if ev.Seq > 0 {
+		fmt.Fprintf(w, "id: %d\n", ev.Seq)
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, payload); err != nil {
+		return err
+	}
+	w.Flush()
+	return nil
+}
+
+// liveRunScript follows a run's event stream on the results page
+func liveRunScript(runID string) string {
+	return `<script>
+(function() {
+	var grid = document.getElementById("results-grid");
+	var status = document.getElementById("run-status");
+	var progress = document.getElementById("run-progress");
+	var session = document.getElementById("session-link");
+	var cancelForm = document.getElementById("cancel-form");
+	var elements = 0, started = 0, done = 0;
+
+	grid.innerHTML = "";
+	var es = new EventSource("/runs/` + runID + `/events");
+	function on(type, fn) {
+		es.addEventListener(type, function(e) { fn(JSON.parse(e.data).data); });
+	}
+	function showProgress(text) {
+		progress.textContent = "elements: " + elements + ", attestations started: " + started + ", results: " + done + " | " + text;
+	}
+
+	on("status", function(run) { status.textContent = run.status; });
+	on("elements_resolved", function(d) { elements = d.count; showProgress("resolved " + d.count + " elements"); });
+	on("session_created", function(d) {
+		session.textContent = d.session_id;
+		session.href = session.dataset.base + d.session_id;
+		showProgress("session created");
+	});
+	on("attestation_started", function(d) { started++; showProgress("attesting " + d.element_id + " for " + d.intent); });
+	on("claim_fetched", function(d) { showProgress("claim " + d.claim_id + " fetched for " + d.element_id); });
+	on("rule_verdict", function(d) { showProgress(d.rule + ": " + d.status + " on " + d.element_id); });
+	on("result", function(d) {
+		done++;
+		grid.insertAdjacentHTML("beforeend", d.html);
+		showProgress("result for " + (d.result.element_name || d.result.element_id) + " / " + d.result.intent);
+	});
+	on("done", function(run) {
+		var text = run.status;
+		if (run.verdict) { text += ", verdict " + run.verdict; }
+		if (run.warnings) { text += ", " + run.warnings + " warnings"; }
+		if (run.elements) {
+			var counts = {};
+			run.elements.forEach(function(e) { counts[e.status] = (counts[e.status] || 0) + 1; });
+			text += " | elements: " + Object.keys(counts).map(function(k) { return counts[k] + " " + k; }).join(", ");
+		}
+		if (run.error) { text += " (" + run.error + ")"; }
+		status.textContent = text;
+		progress.textContent = "";
+		if (cancelForm) { cancelForm.remove(); }
+		es.close();
+	});
+})();
+</script>`
+}
@@ -2,18 +2,20 @@ package web
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"github.com/labstack/echo/v4"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
-	"time"
 
+	"janeauto/config"
 	"janeauto/models"
 	"janeauto/db"
 	"janeauto/jane"
-	"janeauto/attestor"
+	"janeauto/runner"
+	"janeauto/scheduler"
 )
 
 func HomeHandler(c echo.Context) error {
@@ -146,7 +148,7 @@ func AttestFormHandler(c echo.Context) error {
 	return c.HTML(http.StatusOK, html)
 }
 
-// Executes the selected policy and displays the results
+// Queues the selected policy and sends the browser to its results page
 func AttestRunHandler(c echo.Context) error {
 	policyName := c.FormValue("policy")
 	if policyName == "" {
@@ -159,111 +161,71 @@ func AttestRunHandler(c echo.Context) error {
 		return c.String(http.StatusNotFound, "Policy not found")
 	}
 
-	// Executes the policy
-	results, sessionID, err := attestor.ExecutePolicy(policy)
+	// Queues the policy, the run is recorded and executed in the background
+	run, err := runner.Submit(policy, "web:"+c.RealIP())
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "Execution failed: "+err.Error())
+		return c.String(http.StatusServiceUnavailable, "Could not queue run: "+err.Error())
 	}
+	return c.Redirect(http.StatusSeeOther, "/runs/"+run.ID)
+}
+
+// Displays a run and its results. While the run is queued or running the page follows
+// the run's event stream and adds result cards as they arrive.
+func RunPageHandler(c echo.Context) error {
+	run, results, err := runner.Lookup(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusNotFound, "Run not found")
+	}
+	policyName := run.PolicyName
+	revision := ""
+	if run.Revision > 0 {
+		revision = fmt.Sprintf(` (<a href="/policies/%s/diff?to=%d">revision %d</a>)`, policyName, run.Revision, run.Revision)
+	}
+	sessionID := run.SessionID
+	finished := run.Status != models.RunQueued && run.Status != models.RunRunning
 
 	// Builds the JANE session URL
-	sessionURL := buildSessionURL(policy.Jane, sessionID)
+	sessionURL := buildSessionURL(run.JaneURL, sessionID)
 
-	// Current timestamp
-	timestamp := time.Now().Format("02-01-2006 15:04:05")
+	// Run timestamp
+	timestamp := run.QueuedAt.Format("02-01-2006 15:04:05")
 
 	// Build results cards
 	var cards strings.Builder
 	for _, r := range results {
-		// Determines card color class
-		var cardClass string
-		if r.Passed {
-			cardClass = "pass"
-		} else {
-			cardClass = "fail"
-		}
-
-		// Element display: use name if available, otherwise uses eid
-		elementDisplay := r.ElementID
-		if r.ElementName != "" {
-			elementDisplay = r.ElementName
-		}
-
-		// Builds rule details
-		var ruleDetails strings.Builder
-		if len(r.RuleResults) == 0 {
-			ruleDetails.WriteString("<p>No rules executed for this attestation.</p>")
-		} else {
-			ruleDetails.WriteString("<table class='rule-table'><tr><th>Rule</th><th>Result ID</th><th>Status</th></tr>")
-			for _, ruleRes := range r.RuleResults {
-				ruleName, _ := ruleRes["rule"]. (string)
-				resultID, _ := ruleRes["result_id"].(string)
-				status, _ := ruleRes["status"].(string)
-
-				if status == "" {
-					if passed, ok := ruleRes["passed"].(bool); ok && passed {
-						status = "pass"
-					} else {
-						status = "fail"
-					}
-				}
-
-				var statusDisplay, statusClass string
-				switch status {
-				case "pass":
-					statusDisplay = "Pass"
-					statusClass = "status-pass"
-				case "fail":
-					statusDisplay = "Fail"
-					statusClass = "status-fail"
-				case "error":
-					statusDisplay = "Error"
-					statusClass = "status-error"
-				default:
-					statusDisplay = status
-					statusClass = ""
-				}
-
-				// Truncate result ID
-				shortID := resultID
-				if len(shortID) > 8 {
-					shortID = shortID[:8] + "..."
-				}
-
-				ruleDetails.WriteString(fmt.Sprintf(`
-				<tr class="%s">
-					<td>%s</td>
-					<td title="%s">%s</td>
-					<td>%s</td>
-				</tr>`, statusClass, ruleName, resultID, shortID, statusDisplay))
-			}
-			ruleDetails.WriteString("</table>")
-		}
+		cards.WriteString(renderResultCard(r))
+	}
 
-		// Builds the HTML table
-		card := fmt.Sprintf(`
-		<div class="result-card %s">
-			<div class="card-summary">
-				<span class="element">%s</span>
-				<span class="intent">%s</span>
-				<span class="passed-badge">%s</span>
-				<span class="claim-id" title="%s">Claim: %s</span>
-			</div>
-			<details class="card-details">
-				<summary>Show rule details</summary>
-				<div class="details-content">
-					%s
-				</div>
-			</details>
-		</div>`, cardClass, elementDisplay, r.Intent,
-			map[bool]string{true: "Pass", false: "Fail"}[r.Passed],
-			r.ClaimID, truncate(r.ClaimID, 8),
-			ruleDetails.String())
-		cards.WriteString(card)
+	refresh := ""
+	cancelForm := ""
+	live := ""
+	cardsHTML := cards.String()
+	if !finished {
+		// the event stream replays every result, so the cards are only rendered for browsers without JavaScript
+		refresh = `<noscript><meta http-equiv="refresh" content="2"></noscript>`
+		cardsHTML = "<noscript>" + cardsHTML + "</noscript>"
+		cancelForm = fmt.Sprintf(`<form id="cancel-form" action="/runs/%s/cancel" method="POST" style="display:inline"><button type="submit" class="btn-secondary" style="margin-left: 12px;"> Cancel run</button></form>`, run.ID)
+		live = liveRunScript(run.ID)
+	}
+	elementsHTML := ""
+	if finished {
+		elementsHTML = renderElementVerdicts(run.Elements)
+	}
+	status := run.Status
+	if finished && run.Verdict != "" {
+		status += ", verdict " + run.Verdict
+	}
+	if finished && run.Warnings > 0 {
+		status += fmt.Sprintf(", %d warnings", run.Warnings)
+	}
+	if run.Error != "" {
+		status += " (" + run.Error + ")"
 	}
 
 	html := fmt.Sprintf(`<!DOCTYPE html>
 <html>
 <head>
+	%s
 	<title>Attestation Results: %s</title>
 	<style>
 		* { margin: 0; padding: 0; box-sizing: border-box; font-family: system-ui, sans-serif; }
@@ -274,14 +236,19 @@ func AttestRunHandler(c echo.Context) error {
 		.session-info { margin-bottom: 24px; font-size: 0.9rem; color: #475569; }
 		.session-info a { color: #2563eb; text-decoration: none; }
 		.session-info a:hover { text-decoration: underline; }
-		.timestamp { color: #64748b; font-size: 0.9rem; margin-bottom: 24px; }
+		.timestamp { color: #64748b; font-size: 0.9rem; margin-bottom: 8px; }
+		.run-status { color: #475569; font-size: 0.9rem; margin-bottom: 8px; }
+		.run-progress { color: #64748b; font-size: 0.85rem; font-family: monospace; min-height: 1.2em; margin-bottom: 16px; }
 		.results-grid { display: flex; flex-direction: column; gap: 16px; margin-top: 24px; }
 		.result-card { border-radius: 12px; padding: 16px; box-shadow: 0 2px 5px rgba(0,0,0,0.05); transition: all 0.2s; }
 		.result-card.pass { background-color: #f0fdf4; border-left: 6px solid #22c55e; }
 		.result-card.fail { background-color: #fef2f2; border-left: 6px solid #ef4444; color: #7f1d1d; }
-		.result-card.neutral { background-color: f2fce8; border-left: 6px solid #eab308; }
+		.result-card.error { background-color: #fefce8; border-left: 6px solid #f97316; }
+		.result-card.skipped { background-color: #f8fafc; border-left: 6px solid #94a3b8; color: #64748b; }
+		.result-card.neutral { background-color: #fefce8; border-left: 6px solid #eab308; }
 		.card-summary { display: flex; flex-wrap: wrap; align-items: center; gap: 16px; font-size: 1rem; }
 		.element { font-weight: 600; min-width: 150px; }
+		.selected-by { color: #64748b; font-size: 0.85rem; }
 		.intent { font-family: monospace; background: rgba(0,0,0,0.05); padding: 4px 8px; border-radius: 20px; }
 		.passed-badge { font-weight: 500; }
 		.claim-id { color: #475569; font-size: 0.9rem; margin-left: auto; }
@@ -297,28 +264,286 @@ func AttestRunHandler(c echo.Context) error {
 		.status-pass { background-color: #f0fdf4; }
 		.status-fail { background-color: #fef2f2; }
 		.status-error { background-color: #fef9c3; }
+		.status-skipped { background-color: #f1f5f9; color: #64748b; }
+		.rule-detail td { background: #f8fafc; font-size: 0.85rem; color: #334155; }
+		.expected-actual { width: 100%%; margin-top: 6px; border-collapse: collapse; }
+		.expected-actual th { text-align: left; padding: 4px 8px; }
+		.expected-actual td { vertical-align: top; padding: 4px 8px; width: 50%%; }
+		.expected-actual pre { white-space: pre-wrap; word-break: break-all; font-size: 0.8rem; }
+		.result-error { color: #92400e; }
+		.element-verdicts { font-size: 0.9rem; margin-bottom: 16px; }
+		.element-verdicts th, .element-verdicts td { text-align: left; padding: 4px 12px 4px 0; }
+		.warnings { margin-top: 8px; color: #854d0e; font-size: 0.9rem; }
+		ul.warnings { margin-left: 20px; }
+		.stopped { margin-top: 8px; color: #7f1d1d; font-size: 0.9rem; }
 	</style>
 </head>
 <body>
 	<div class="container">
 		<h2> Attestation Results: %s</h2>
-		<div class="policy-name">Policy: %s</div>
-		<div class="session-info">Session: <a href="%s" target= "_blank">%s</a></div>
+		<div class="policy-name">Policy: %s%s</div>
+		<div class="session-info">Session: <a id="session-link" data-base="%s" href="%s" target= "_blank">%s</a></div>
 		<div class="timestamp">Executed on: %s</div>
+		<div class="run-status">Run %s: <span id="run-status">%s</span></div>
+		<div class="run-progress" id="run-progress"></div>
+		<div id="element-verdicts">%s</div>
 
-		<div class="results-grid">
+		<div class="results-grid" id="results-grid">
 			%s
 		</div>
 
 		<a href="/attest" class="btn-secondary"> Run another policy</a>
 		<a href="/" class="btn-secondary" style="margin-left: 12px;"> Home</a>
+		%s
 	</div>
+	%s
 </body>
-</html>`, policyName, policyName, policyName, sessionURL, sessionID, timestamp, cards.String())
+</html>`, refresh, policyName, policyName, policyName, revision, buildSessionURL(run.JaneURL, ""), sessionURL, sessionID, timestamp, run.ID, status, elementsHTML, cardsHTML, cancelForm, live)
 
 	return c.HTML(http.StatusOK, html)
 }
 
+// Builds the per-element verdict table of a finished run
+func renderElementVerdicts(elements []models.ElementVerdict) string {
+	if len(elements) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("<table class='element-verdicts'><tr><th>Element</th><th>Verdict</th><th>Attestations</th><th>Warnings</th></tr>")
+	for _, e := range elements {
+		name := e.ElementID
+		if e.ElementName != "" {
+			name = e.ElementName
+		}
+		b.WriteString(fmt.Sprintf("<tr class='status-%s'><td title='%s'>%s</td><td>%s</td><td>%d</td><td>%d</td></tr>",
+			e.Status, e.ElementID, name, e.Status, e.Attestations, e.Warnings))
+	}
+	b.WriteString("</table>")
+	return b.String()
+}
+
+// Builds the HTML card for one attestation result
+func renderResultCard(r models.AttestationResult) string {
+	// Determines card color class
+	var cardClass, badge string
+	switch r.EffectiveStatus() {
+	case models.StatusPass:
+		cardClass, badge = "pass", "Pass"
+		if len(r.Warnings) > 0 {
+			cardClass, badge = "neutral", fmt.Sprintf("Pass (%d warnings)", len(r.Warnings))
+		}
+	case models.StatusError:
+		cardClass, badge = "error", "Error"
+		if r.Error != nil {
+			badge = "Error: " + errorKindLabel(r.Error.Kind)
+		}
+	case models.StatusSkipped:
+		cardClass, badge = "skipped", "Skipped"
+	default:
+		cardClass, badge = "fail", "Fail"
+	}
+
+	// Element display: use name if available, otherwise uses eid
+	elementDisplay := r.ElementID
+	if r.ElementName != "" {
+		elementDisplay = r.ElementName
+	}
+
+	// Builds rule details
+	var ruleDetails strings.Builder
+	if len(r.RuleResults) == 0 {
+		ruleDetails.WriteString("<p>No rules executed for this attestation.</p>")
+	} else {
+		ruleDetails.WriteString("<table class='rule-table'><tr><th>Rule</th><th>Decision</th><th>Result ID</th><th>Status</th><th>Explanation</th></tr>")
+		for _, ruleRes := range r.RuleResults {
+			ruleName, _ := ruleRes["rule"]. (string)
+			resultID, _ := ruleRes["result_id"].(string)
+			status, _ := ruleRes["status"].(string)
+			decision, _ := ruleRes["decision"].(string)
+			if decision == "" {
+				decision = models.DecisionRequired
+			}
+			explanation := ruleExplanation(ruleRes)
+
+			if status == "" {
+				if passed, ok := ruleRes["passed"].(bool); ok && passed {
+					status = "pass"
+				} else {
+					status = "fail"
+				}
+			}
+
+			var statusDisplay, statusClass string
+			switch status {
+			case "pass":
+				statusDisplay = "Pass"
+				statusClass = "status-pass"
+			case "fail":
+				statusDisplay = "Fail"
+				statusClass = "status-fail"
+			case "error":
+				statusDisplay = "Error"
+				statusClass = "status-error"
+			case "skipped":
+				statusDisplay = "Skipped"
+				statusClass = "status-skipped"
+			default:
+				statusDisplay = status
+				statusClass = ""
+			}
+
+			// Truncate result ID
+			shortID := resultID
+			if len(shortID) > 8 {
+				shortID = shortID[:8] + "..."
+			}
+
+			ruleDetails.WriteString(fmt.Sprintf(`
+			<tr class="%s">
+				<td>%s</td>
+				<td>%s</td>
+				<td title="%s">%s</td>
+				<td>%s</td>
+				<td>%s</td>
+			</tr>`, statusClass, ruleName, decision, resultID, shortID, statusDisplay, explanation))
+			ruleDetails.WriteString(renderRuleDetail(ruleRes))
+		}
+		ruleDetails.WriteString("</table>")
+	}
+	if len(r.Warnings) > 0 {
+		ruleDetails.WriteString("<p class='warnings'><b>Warnings:</b></p><ul class='warnings'>")
+		for _, w := range r.Warnings {
+			ruleDetails.WriteString("<li>" + w + "</li>")
+		}
+		ruleDetails.WriteString("</ul>")
+	}
+	if r.StoppedBy != "" {
+		ruleDetails.WriteString(fmt.Sprintf("<p class='stopped'>Stopped by fail-fast rule %s, remaining rules and attestations of this element were not run.</p>", r.StoppedBy))
+	}
+
+	// Builds the HTML table
+	return fmt.Sprintf(`
+	<div class="result-card %s">
+		<div class="card-summary">
+			<span class="element">%s</span>
+			<span class="selected-by">%s</span>
+			<span class="intent">%s</span>
+			<span class="passed-badge">%s</span>
+			<span class="claim-id" title="%s">Claim: %s</span>
+			<span class="claim-wait">%s</span>
+		</div>
+		<details class="card-details">
+			<summary>Show rule details</summary>
+			<div class="details-content">
+				%s
+			</div>
+		</details>
+	</div>`, cardClass, elementDisplay, strings.Join(r.SelectedBy, ", "), r.Intent,
+		badge,
+		r.ClaimID, truncate(r.ClaimID, 8),
+		claimWaitText(r),
+		ruleDetails.String())
+}
+
+// Helper to show how long the claim of a result took to appear
+func claimWaitText(r models.AttestationResult) string {
+	if r.ClaimWaitMs == 0 {
+		return ""
+	}
+	wait := fmt.Sprintf("%.1fs", float64(r.ClaimWaitMs)/1000)
+	if r.Error != nil && r.Error.Kind == models.ErrorKindTimeout {
+		return "waited " + wait + " for the claim"
+	}
+	return "claim after " + wait
+}
+
+// Builds the row under a rule with the message and expected-vs-actual values of its result document
+func renderRuleDetail(ruleRes map[string]interface{}) string {
+	var parts []string
+	if msg, ok := ruleRes["message"]; ok {
+		parts = append(parts, "<div><b>Message:</b> "+html.EscapeString(detailValue(msg))+"</div>")
+	}
+	expected, hasExpected := ruleRes["expected"]
+	actual, hasActual := ruleRes["actual"]
+	if hasExpected || hasActual {
+		parts = append(parts, fmt.Sprintf(`<table class="expected-actual"><tr><th>Expected</th><th>Actual</th></tr><tr><td><pre>%s</pre></td><td><pre>%s</pre></td></tr></table>`,
+			html.EscapeString(detailValue(expected)), html.EscapeString(detailValue(actual))))
+	}
+	if e, ok := ruleRes["result_error"].(string); ok {
+		parts = append(parts, "<div class='result-error'>Result document unavailable: "+html.EscapeString(e)+"</div>")
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return `
+			<tr class="rule-detail"><td colspan="5">` + strings.Join(parts, "") + `</td></tr>`
+}
+
+// Helper to show a value from a result document, strings as they are and anything else as JSON
+func detailValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "-"
+	case string:
+		return v
+	}
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// Helper to name an error kind in the UI
+func errorKindLabel(kind string) string {
+	switch kind {
+	case models.ErrorKindTimeout:
+		return "JANE timed out"
+	case models.ErrorKindNotFound:
+		return "not found on JANE"
+	case models.ErrorKindJane:
+		return "JANE error"
+	case models.ErrorKindUnreachable:
+		return "JANE unreachable"
+	case models.ErrorKindCancelled:
+		return "cancelled"
+	case models.ErrorKindCircuitOpen:
+		return "JANE unavailable (circuit breaker open)"
+	}
+	return kind
+}
+
+// Helper to describe a rule result: the catalogue's explanation of its result code,
+// or the error that kept the rule from running
+func ruleExplanation(ruleRes map[string]interface{}) string {
+	if e, ok := ruleRes["error"].(string); ok && e != "" {
+		if kind, _ := ruleRes["error_kind"].(string); kind != "" {
+			return errorKindLabel(kind) + ": " + e
+		}
+		return e
+	}
+	text, _ := ruleRes["explanation"].(string)
+	var notes []string
+	if code, ok := ruleRes["code"]; ok {
+		notes = append(notes, fmt.Sprintf("code %v", code))
+	}
+	if severity, _ := ruleRes["severity"].(string); severity != "" {
+		notes = append(notes, "severity "+severity)
+	}
+	if len(notes) > 0 {
+		text = strings.TrimSpace(text + " (" + strings.Join(notes, ", ") + ")")
+	}
+	return text
+}
+
+// Helper to show how a collection combines its tags
+func tagMatch(m string) string {
+	if strings.EqualFold(m, models.TagMatchAnd) {
+		return "all"
+	}
+	return "any"
+}
+
 // Helper to truncate strings
 func truncate(s string, n int) string {
 	if len(s) <= n {
@@ -336,27 +561,42 @@ func PoliciesHandler(c echo.Context) error {
 	var html strings.Builder
 	html.WriteString("<!DOCTYPE html><html><head><title>Policies</title></head><body>")
 	html.WriteString("<h1>All Policies</h1>")
+	html.WriteString(`<p><a href="/policies/import">Import from a provisioning file</a></p>`)
 
 	for _, policy := range policies {
 		html.WriteString(fmt.Sprintf(`
 	    	<h2>%s</h2>
 	    	<p><b>Description:</b> %s</p>
 	    	<p><b>Jane:</b> %s</p>
+	    	<p><b>Revision:</b> %d (<a href="/policies/%s/history">history</a>)</p>
 	    	<h3>Collection</h3>
 	    	<p><b>Items:</b> %v</p>
-	    	<p><b>Tags:</b> %v</p>
+	    	<p><b>Tags:</b> %v (match %s)</p>
 	    	<p><b>Names:</b> %v</p>
-	    	<form action="/execute/%s" method="post">
+	    	%s
+	    	<form action="/execute/%s" method="post" style="display:inline">
 		    <button type="submit">Execute</button>
 	    	</form>
+	    	<form action="/policies/%s/plan" method="get" style="display:inline">
+		    <button type="submit">Preview</button>
+	    	</form>
+	    	<form action="/policies/%s/lint" method="get" style="display:inline">
+		    <button type="submit">Lint</button>
+	    	</form>
 	    	<hr>
 	`,
 			policy.Name,
 			policy.Description,
 			policy.Jane,
+			policy.Revision,
+			policy.Name,
 			strings.Join(policy.Collection.Items, ", "),
 			strings.Join(policy.Collection.Tags, ", "),
+			tagMatch(policy.Collection.TagMatch),
 			strings.Join(policy.Collection.Names, ", "),
+			renderSchedule(policy),
+			policy.Name,
+			policy.Name,
 			policy.Name,
 		))
 	}
@@ -365,6 +605,44 @@ func PoliciesHandler(c echo.Context) error {
 	return c.HTML(http.StatusOK, html.String())
 }
 
+// renderSchedule describes a policy's schedule with its next and last fire times
+func renderSchedule(policy models.Policy) string {
+	if policy.Schedule == nil || policy.Schedule.Cron == "" {
+		return "<p><b>Schedule:</b> none</p>"
+	}
+	s := policy.Schedule
+	desc := s.Cron
+	if s.Timezone != "" {
+		desc += " (" + s.Timezone + ")"
+	}
+	if s.Jitter != "" {
+		desc += ", jitter " + s.Jitter
+	}
+
+	entry, ok := scheduler.Lookup(policy.Name)
+	if !ok {
+		return fmt.Sprintf("<p><b>Schedule:</b> %s, not active</p>", desc)
+	}
+	const layout = "2006-01-02 15:04:05 MST"
+	next, last := "-", "never"
+	if !entry.Next.IsZero() {
+		next = entry.Next.Format(layout)
+	}
+	if !entry.Last.IsZero() {
+		last = entry.Last.Format(layout)
+		if entry.LastSkipped {
+			last += " (skipped, previous run still going)"
+		} else if entry.LastRunID != "" {
+			last += fmt.Sprintf(` (<a href="/runs/%s">run</a>)`, entry.LastRunID)
+		}
+	}
+	out := fmt.Sprintf("<p><b>Schedule:</b> %s<br><b>Next run:</b> %s<br><b>Last run:</b> %s</p>", desc, next, last)
+	if entry.Error != "" {
+		out += fmt.Sprintf(`<p style="color: red;">Schedule error: %s</p>`, entry.Error)
+	}
+	return out
+}
+
 func ExecutePolicyHandler(c echo.Context) error {
 	policyName := c.Param("policyName")
 	fmt.Printf("\n=== STARTING EXECUTE POLICY HANDLER: %s ===\n", policyName)
@@ -375,20 +653,31 @@ func ExecutePolicyHandler(c echo.Context) error {
 		return c.String(http.StatusNotFound, "Policy not found")
 	}
 
-	results, _, err := attestor.ExecutePolicy(policy)
+	run, err := runner.Submit(policy, "web:"+c.RealIP())
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "Execution failed: "+err.Error())
+		return c.String(http.StatusServiceUnavailable, "Could not queue run: "+err.Error())
 	}
 
-	// returns JSON response
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"results": results,
-		"count:":  len(results),
+	// returns JSON response, the run continues in the background
+	c.Response().Header().Set(echo.HeaderLocation, "/api/v1/runs/"+run.ID)
+	return c.JSON(http.StatusAccepted, map[string]interface{}{
+		"run_id":     run.ID,
+		"status":     run.Status,
+		"status_url": "/api/v1/runs/" + run.ID,
 	})
 }
 
+// Cancels a run from its results page
+func CancelRunHandler(c echo.Context) error {
+	id := c.Param("id")
+	if err := runner.Cancel(id); err != nil && !errors.Is(err, runner.ErrNotRunning) {
+		return c.String(http.StatusNotFound, "Could not cancel run: "+err.Error())
+	}
+	return c.Redirect(http.StatusSeeOther, "/runs/"+id)
+}
+
 // This function constructs the JANE web UI session URL
-// it takes the API base url and the session ID, and returns a URL pointing to the UI on port 8540
+// it takes the API base url and the session ID, and returns a URL pointing to the UI on the configured UI port
 func buildSessionURL(apiURL, sessionID string) string {
 	u, err := url.Parse(apiURL)
 	if err != nil {
@@ -396,22 +685,25 @@ func buildSessionURL(apiURL, sessionID string) string {
 		return apiURL + "/session/" + sessionID
 	}
 
-	// Replaces port with 8540
+	// Replaces port with the UI port
+	uiPort := fmt.Sprintf(":%d", config.ConfigData.Jane.UIPort)
 	hostParts := strings.Split(u.Host, ":")
 	if len(hostParts) == 2 {
-		u.Host = hostParts[0] + ":8540"
+		u.Host = hostParts[0] + uiPort
 	} else {
-		// no port specified, just add 8540
-		u.Host = u.Host + ":8540"
+		// no port specified, just add the UI port
+		u.Host = u.Host + uiPort
 	}
 	//Ensures path ends with /session/ID
 	return u.String() + "/session/" + sessionID
 }
 
 func DebugJaneHandler(c echo.Context) error {
-	janeBaseURL := "http://localhost:8520"
+	janeBaseURL := config.ConfigData.Jane.URL
+	client := jane.For(janeBaseURL)
+	ctx := c.Request().Context()
 
-	elements, err := jane.GetElementsByName(janeBaseURL,"bobafet")
+	elements, err := client.GetElementsByName(ctx, "bobafet")
 	if err != nil {
 		return c.JSON(500, map[string]interface{}{
 			"error":   "Failed to get elements",
@@ -419,12 +711,9 @@ func DebugJaneHandler(c echo.Context) error {
 		})
 	}
 
-	intentsResp, err := http.Get(janeBaseURL + "/intents")
 	var intentsData interface{}
-	if err == nil {
-		defer intentsResp.Body.Close()
-		body, _ := ioutil.ReadAll(intentsResp.Body)
-		json.Unmarshal(body, &intentsData)
+	if intents, err := client.ListIntents(ctx); err == nil {
+		intentsData = map[string]interface{}{"intents": intents}
 	}
 
 	return c.JSON(200, map[string]interface{}{
@@ -435,14 +724,15 @@ func DebugJaneHandler(c echo.Context) error {
 }
 
 func DebugAttestation(c echo.Context) error {
-	janeURL := "http://localhost:8520"
+	client := jane.For(config.ConfigData.Jane.URL)
+	ctx := c.Request().Context()
 
-	sid, err := jane.CreateSession(janeURL)
+	sid, err := client.CreateSession(ctx)
 	if err != nil {
 		return c.JSON(500, map[string]string{"error": err.Error()})
 	}
 
-	claimID, err := jane.RunAttestation(janeURL, "2d1e8307-3987-4bcf-a182-2b3504394a4e", "std::intent::sys::info", "tarzan", sid)
+	claimID, err := client.RunAttestation(ctx, "2d1e8307-3987-4bcf-a182-2b3504394a4e", "std::intent::sys::info", "tarzan", sid, nil)
 	if err != nil {
 		return c.JSON(500, map[string]string{"error": err.Error()})
 	}
@@ -0,0 +1,87 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"janeauto/db"
+	"janeauto/models"
+	"janeauto/provisioning"
+)
+
+// Shows the form for importing a policy from a JANE provisioning file
+func ImportFormHandler(c echo.Context) error {
+	return c.HTML(http.StatusOK, importPage(""))
+}
+
+// Converts an uploaded provisioning file into a policy and stores it
+func ImportUploadHandler(c echo.Context) error {
+	fh, err := c.FormFile("provfile")
+	if err != nil {
+		return c.HTML(http.StatusBadRequest, importPage("Choose a provisioning file to upload."))
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return c.HTML(http.StatusBadRequest, importPage("Could not read the upload: "+err.Error()))
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, 1<<20))
+	if err != nil {
+		return c.HTML(http.StatusBadRequest, importPage("Could not read the upload: "+err.Error()))
+	}
+
+	policy, err := provisioning.ToPolicy(data, c.FormValue("name"))
+	if err != nil {
+		var verr *models.ValidationError
+		if errors.As(err, &verr) {
+			msg := "The imported policy is not valid:<ul>"
+			for _, fe := range verr.Errors {
+				msg += "<li>" + html.EscapeString(fe.Field+": "+fe.Message) + "</li>"
+			}
+			return c.HTML(http.StatusUnprocessableEntity, importPage(msg+"</ul>"))
+		}
+		return c.HTML(http.StatusBadRequest, importPage(html.EscapeString(err.Error())))
+	}
+
+	policy.Source = models.SourceAPI
+	author, _ := changeInfo(c, "web", "")
+	if err := db.CreatePolicy(policy, author, "imported from "+fh.Filename); err != nil {
+		if errors.Is(err, db.ErrDuplicate) {
+			return c.HTML(http.StatusConflict, importPage(fmt.Sprintf("A policy named %s already exists, choose another name.", html.EscapeString(policy.Name))))
+		}
+		return c.HTML(http.StatusInternalServerError, importPage("Could not store the policy: "+html.EscapeString(err.Error())))
+	}
+	return c.Redirect(http.StatusSeeOther, "/policies")
+}
+
+func importPage(message string) string {
+	if message != "" {
+		message = `<div style="color: #b91c1c; margin-bottom: 16px;">` + message + `</div>`
+	}
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+	<title>Import policy</title>
+	<style>
+		body { font-family: system-ui, sans-serif; padding: 24px; }
+		label { display: block; margin-top: 12px; }
+	</style>
+</head>
+<body>
+	<h1>Import a policy from a provisioning file</h1>
+	<p>The element's name and tags become the collection, and the intents of the attest and evs sections become the attestations.</p>
+	%s
+	<form action="/policies/import" method="post" enctype="multipart/form-data">
+		<label>Provisioning file <input type="file" name="provfile" accept=".yaml,.yml"></label>
+		<label>Policy name (optional) <input type="text" name="name"></label>
+		<p><button type="submit">Import</button></p>
+	</form>
+	<p><a href="/policies">Back to policies</a></p>
+</body>
+</html>`, message)
+}
@@ -0,0 +1,82 @@
+package web
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"janeauto/attestor"
+	"janeauto/db"
+)
+
+// GET /api/v1/policies/:name/lint checks a stored policy against its JANE
+func APILintPolicyHandler(c echo.Context) error {
+	name := c.Param("name")
+	policy, err := db.GetPolicyByName(name)
+	if err != nil {
+		return apiStoreError(err, name)
+	}
+	return c.JSON(http.StatusOK, attestor.LintPolicy(c.Request().Context(), policy))
+}
+
+// POST /api/v1/lint checks the policy in the body against its JANE without storing it
+func APILintHandler(c echo.Context) error {
+	body, err := readBody(c)
+	if err != nil {
+		return err
+	}
+	policy, err := decodePolicy(body)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, attestor.LintPolicy(c.Request().Context(), policy))
+}
+
+// Shows the lint findings of a policy, reached from the Lint button on the policies page
+func LintPageHandler(c echo.Context) error {
+	name := c.Param("name")
+	policy, err := db.GetPolicyByName(name)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Policy not found")
+	}
+	report := attestor.LintPolicy(c.Request().Context(), policy)
+
+	var issues strings.Builder
+	if len(report.Issues) == 0 {
+		issues.WriteString("<p>No problems found.</p>")
+	} else {
+		issues.WriteString("<table><tr><th>Severity</th><th>Field</th><th>Problem</th></tr>")
+		for _, i := range report.Issues {
+			issues.WriteString(fmt.Sprintf(`<tr class="%s"><td>%s</td><td>%s</td><td>%s</td></tr>`,
+				i.Severity, i.Severity, html.EscapeString(i.Field), html.EscapeString(i.Message)))
+		}
+		issues.WriteString("</table>")
+	}
+
+	page := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+	<title>Lint: %s</title>
+	<style>
+		body { font-family: system-ui, sans-serif; padding: 24px; }
+		table { border-collapse: collapse; margin-bottom: 16px; }
+		th, td { text-align: left; padding: 4px 12px; border-bottom: 1px solid #e2e8f0; }
+		.error { color: #b91c1c; }
+		.warning { color: #92400e; }
+		.info { color: #64748b; }
+	</style>
+</head>
+<body>
+	<h1>Lint for %s</h1>
+	<p><b>JANE:</b> %s</p>
+	%s
+	<p><a href="/policies/%s/plan">Preview</a> | <a href="/policies">Back to policies</a></p>
+</body>
+</html>`, html.EscapeString(report.Policy), html.EscapeString(report.Policy), html.EscapeString(report.JaneURL),
+		issues.String(), report.Policy)
+
+	return c.HTML(http.StatusOK, page)
+}
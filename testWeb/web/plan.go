@@ -0,0 +1,97 @@
+package web
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"janeauto/attestor"
+	"janeauto/db"
+)
+
+// GET /api/v1/policies/:name/plan shows what running the policy would do, without attesting anything
+func APIPlanPolicyHandler(c echo.Context) error {
+	name := c.Param("name")
+	policy, err := db.GetPolicyByName(name)
+	if err != nil {
+		return apiStoreError(err, name)
+	}
+
+	plan, err := attestor.PlanPolicy(c.Request().Context(), policy)
+	if err != nil {
+		return apiError(c, http.StatusBadGateway, err.Error())
+	}
+	return c.JSON(http.StatusOK, plan)
+}
+
+// Shows the plan of a policy, reached from the Preview button on the policies page
+func PlanPageHandler(c echo.Context) error {
+	name := c.Param("name")
+	policy, err := db.GetPolicyByName(name)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Policy not found")
+	}
+
+	plan, err := attestor.PlanPolicy(c.Request().Context(), policy)
+	if err != nil {
+		return c.String(http.StatusBadGateway, "Could not plan policy: "+err.Error())
+	}
+
+	var elements strings.Builder
+	if len(plan.Elements) == 0 {
+		elements.WriteString("<p>The collection does not resolve to any element.</p>")
+	} else {
+		elements.WriteString("<table><tr><th>Element</th><th>Name</th><th>Selected by</th></tr>")
+		for _, e := range plan.Elements {
+			elements.WriteString(fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%s</td></tr>",
+				html.EscapeString(e.ElementID), html.EscapeString(e.ElementName), html.EscapeString(strings.Join(e.SelectedBy, ", "))))
+		}
+		elements.WriteString("</table>")
+	}
+	if len(plan.Unresolved) > 0 {
+		elements.WriteString(fmt.Sprintf(`<p class="missing">Selected no element: %s</p>`, html.EscapeString(strings.Join(plan.Unresolved, ", "))))
+	}
+
+	var intents strings.Builder
+	intents.WriteString("<table><tr><th>Intent</th><th>Endpoint</th><th>JANE ItemID</th><th>Rules</th></tr>")
+	for _, i := range plan.Intents {
+		itemID := html.EscapeString(i.ItemID)
+		class := ""
+		if !i.Found {
+			itemID, class = "missing on JANE", ` class="missing"`
+		}
+		intents.WriteString(fmt.Sprintf("<tr%s><td>%s</td><td>%s</td><td>%s</td><td>%d</td></tr>",
+			class, html.EscapeString(i.Intent), html.EscapeString(i.Endpoint), itemID, i.Rules))
+	}
+	intents.WriteString("</table>")
+
+	page := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+	<title>Plan: %s</title>
+	<style>
+		body { font-family: system-ui, sans-serif; padding: 24px; }
+		table { border-collapse: collapse; margin-bottom: 16px; }
+		th, td { text-align: left; padding: 4px 12px; border-bottom: 1px solid #e2e8f0; }
+		.missing { color: #b91c1c; }
+	</style>
+</head>
+<body>
+	<h1>Plan for %s</h1>
+	<p><b>JANE:</b> %s</p>
+	<p><b>Calls a run would make:</b> %d /attest, up to %d /verify</p>
+	<h2>Elements (%d)</h2>
+	%s
+	<h2>Intents</h2>
+	%s
+	<form action="/execute/%s" method="post"><button type="submit">Execute</button></form>
+	<p><a href="/policies">Back to policies</a></p>
+</body>
+</html>`, html.EscapeString(plan.Policy), html.EscapeString(plan.Policy), html.EscapeString(plan.JaneURL),
+		plan.AttestCalls, plan.VerifyCalls, len(plan.Elements), elements.String(), intents.String(), plan.Policy)
+
+	return c.HTML(http.StatusOK, page)
+}
@@ -0,0 +1,350 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"janeauto/db"
+	"janeauto/models"
+	"janeauto/scheduler"
+)
+
+// DiffLine is one line of a diff between two revisions
+type DiffLine struct {
+	Op   string `json:"op"` // "+" added, "-" removed, " " unchanged
+	Text string `json:"text"`
+}
+
+// RevisionDiff compares two revisions of a policy. Revision 0 stands for no policy at all.
+type RevisionDiff struct {
+	Policy string     `json:"policy"`
+	From   int        `json:"from"`
+	To     int        `json:"to"`
+	Fields []string   `json:"fields"` // top-level fields that changed
+	Lines  []DiffLine `json:"lines"`
+}
+
+// diffRevisions compares revision from with revision to of the named policy
+func diffRevisions(name string, from, to int) (*RevisionDiff, error) {
+	var docs [2]*models.Policy
+	for i, n := range []int{from, to} {
+		if n == 0 {
+			docs[i] = &models.Policy{}
+			continue
+		}
+		rev, err := db.GetRevision(name, n)
+		if err != nil {
+			return nil, err
+		}
+		docs[i] = rev.Document
+	}
+	return &RevisionDiff{
+		Policy: name,
+		From:   from,
+		To:     to,
+		Fields: models.ChangedFields(docs[0], docs[1]),
+		Lines:  diffLines(revisionLines(docs[0], from), revisionLines(docs[1], to)),
+	}, nil
+}
+
+// revisionLines is the indented JSON of a policy without its revision number, which always differs
+func revisionLines(p *models.Policy, number int) []string {
+	if number == 0 {
+		return nil
+	}
+	doc := *p
+	doc.Revision = 0
+	out, _ := json.MarshalIndent(doc, "", "  ")
+	return strings.Split(string(out), "\n")
+}
+
+// diffLines is a line diff along the longest common subsequence of a and b
+func diffLines(a, b []string) []DiffLine {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []DiffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, DiffLine{Op: " ", Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, DiffLine{Op: "-", Text: a[i]})
+			i++
+		default:
+			lines = append(lines, DiffLine{Op: "+", Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, DiffLine{Op: "-", Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, DiffLine{Op: "+", Text: b[j]})
+	}
+	return lines
+}
+
+// restoreRevision saves an old revision of a policy as its newest one. A deleted policy is created again.
+// The policy stays managed where it currently is.
+func restoreRevision(name string, number int, author, note string) (*models.Policy, error) {
+	rev, err := db.GetRevision(name, number)
+	if err != nil {
+		return nil, err
+	}
+	policy := *rev.Document
+	if note == "" {
+		note = fmt.Sprintf("restored revision %d", number)
+	} else {
+		note = fmt.Sprintf("restored revision %d: %s", number, note)
+	}
+
+	current, err := db.GetPolicyByName(name)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		err = db.CreatePolicy(&policy, author, note)
+	case err == nil:
+		policy.Source = current.Source
+		err = db.ReplacePolicy(name, &policy, author, note)
+	}
+	if err != nil {
+		return nil, err
+	}
+	scheduler.Reload()
+	return &policy, nil
+}
+
+func revisionParam(c echo.Context, param string) (int, error) {
+	n, err := strconv.Atoi(c.Param(param))
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("revision %q is not a positive number", c.Param(param))
+	}
+	return n, nil
+}
+
+// GET /api/v1/policies/:name/revisions lists the revisions of a policy, newest first
+func APIListRevisionsHandler(c echo.Context) error {
+	name := c.Param("name")
+	revisions, err := db.ListRevisions(name)
+	if err != nil {
+		return apiError(c, http.StatusInternalServerError, err.Error())
+	}
+	if len(revisions) == 0 {
+		return apiStoreError(db.ErrNotFound, name)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"policy":    name,
+		"revisions": revisions,
+		"count":     len(revisions),
+	})
+}
+
+// GET /api/v1/policies/:name/revisions/:rev returns a revision with the policy as it was saved
+func APIGetRevisionHandler(c echo.Context) error {
+	name := c.Param("name")
+	n, err := revisionParam(c, "rev")
+	if err != nil {
+		return apiError(c, http.StatusBadRequest, err.Error())
+	}
+	rev, err := db.GetRevision(name, n)
+	if err != nil {
+		return revisionStoreError(c, err, name, n)
+	}
+	return c.JSON(http.StatusOK, rev)
+}
+
+// GET /api/v1/policies/:name/revisions/:rev/diff?against=N compares a revision with revision N,
+// by default the one before it
+func APIDiffRevisionHandler(c echo.Context) error {
+	name := c.Param("name")
+	n, err := revisionParam(c, "rev")
+	if err != nil {
+		return apiError(c, http.StatusBadRequest, err.Error())
+	}
+	against := n - 1
+	if v := c.QueryParam("against"); v != "" {
+		against, err = strconv.Atoi(v)
+		if err != nil || against < 0 {
+			return apiError(c, http.StatusBadRequest, fmt.Sprintf("against %q is not a revision number", v))
+		}
+	}
+	diff, err := diffRevisions(name, against, n)
+	if err != nil {
+		return revisionStoreError(c, err, name, n)
+	}
+	return c.JSON(http.StatusOK, diff)
+}
+
+// POST /api/v1/policies/:name/revisions/:rev/restore saves the revision as the newest one
+func APIRestoreRevisionHandler(c echo.Context) error {
+	name := c.Param("name")
+	n, err := revisionParam(c, "rev")
+	if err != nil {
+		return apiError(c, http.StatusBadRequest, err.Error())
+	}
+	author, note := changeInfo(c, "api", "")
+	policy, err := restoreRevision(name, n, author, note)
+	if err != nil {
+		return revisionStoreError(c, err, name, n)
+	}
+	return c.JSON(http.StatusOK, policy)
+}
+
+func revisionStoreError(c echo.Context, err error, name string, n int) error {
+	if errors.Is(err, db.ErrNotFound) {
+		return apiError(c, http.StatusNotFound, fmt.Sprintf("policy '%s' has no revision %d", name, n))
+	}
+	return apiStoreError(err, name)
+}
+
+// Lists the revisions of a policy with links to their diffs and buttons to restore them
+func HistoryPageHandler(c echo.Context) error {
+	name := c.Param("name")
+	revisions, err := db.ListRevisions(name)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error retrieving revisions: "+err.Error())
+	}
+	if len(revisions) == 0 {
+		return c.String(http.StatusNotFound, "Policy has no revisions")
+	}
+	current := 0
+	if policy, err := db.GetPolicyByName(name); err == nil {
+		current = policy.Revision
+	}
+
+	var rows strings.Builder
+	for _, r := range revisions {
+		action := fmt.Sprintf(`<form action="/policies/%s/revisions/%d/restore" method="post">
+			<input name="note" placeholder="why">
+			<button type="submit">Restore</button>
+		</form>`, name, r.Number)
+		if r.Number == current {
+			action = "current"
+		}
+		rows.WriteString(fmt.Sprintf(`<tr><td>%d</td><td>%s</td><td>%s</td><td>%s</td><td><a href="/policies/%s/diff?to=%d">diff</a></td><td>%s</td></tr>`,
+			r.Number, r.Time.Format("2006-01-02 15:04:05 MST"), html.EscapeString(r.Author), html.EscapeString(r.Note), name, r.Number, action))
+	}
+
+	page := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+	<title>History: %s</title>
+	<style>
+		body { font-family: system-ui, sans-serif; padding: 24px; }
+		table { border-collapse: collapse; margin-bottom: 16px; }
+		th, td { text-align: left; padding: 4px 12px; border-bottom: 1px solid #e2e8f0; vertical-align: top; }
+		form { display: inline; }
+	</style>
+</head>
+<body>
+	<h1>History of %s</h1>
+	<table>
+		<tr><th>Revision</th><th>Saved</th><th>Author</th><th>Note</th><th></th><th></th></tr>
+		%s
+	</table>
+	<p><a href="/policies">Back to policies</a></p>
+</body>
+</html>`, html.EscapeString(name), html.EscapeString(name), rows.String())
+
+	return c.HTML(http.StatusOK, page)
+}
+
+// Shows the diff between two revisions; to defaults to the newest, from to the one before to
+func DiffPageHandler(c echo.Context) error {
+	name := c.Param("name")
+	revisions, err := db.ListRevisions(name)
+	if err != nil || len(revisions) == 0 {
+		return c.String(http.StatusNotFound, "Policy has no revisions")
+	}
+	to := revisions[0].Number
+	if v := c.QueryParam("to"); v != "" {
+		if to, err = strconv.Atoi(v); err != nil {
+			return c.String(http.StatusBadRequest, "Invalid revision "+v)
+		}
+	}
+	from := to - 1
+	if v := c.QueryParam("from"); v != "" {
+		if from, err = strconv.Atoi(v); err != nil {
+			return c.String(http.StatusBadRequest, "Invalid revision "+v)
+		}
+	}
+
+	diff, err := diffRevisions(name, from, to)
+	if err != nil {
+		return c.String(http.StatusNotFound, fmt.Sprintf("Cannot compare revisions %d and %d: %v", from, to, err))
+	}
+
+	var lines strings.Builder
+	for _, l := range diff.Lines {
+		class := "same"
+		switch l.Op {
+		case "+":
+			class = "added"
+		case "-":
+			class = "removed"
+		}
+		lines.WriteString(fmt.Sprintf(`<div class="%s">%s %s</div>`, class, l.Op, html.EscapeString(l.Text)))
+	}
+	fields := "none"
+	if len(diff.Fields) > 0 {
+		fields = html.EscapeString(strings.Join(diff.Fields, ", "))
+	}
+
+	page := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+	<title>Diff: %s</title>
+	<style>
+		body { font-family: system-ui, sans-serif; padding: 24px; }
+		.diff { font-family: monospace; white-space: pre; font-size: 0.85rem; border: 1px solid #e2e8f0; padding: 8px; }
+		.added { background: #f0fdf4; color: #166534; }
+		.removed { background: #fef2f2; color: #991b1b; }
+		.same { color: #64748b; }
+	</style>
+</head>
+<body>
+	<h1>%s: revision %d against %d</h1>
+	<p><b>Changed fields:</b> %s</p>
+	<div class="diff">%s</div>
+	<p><a href="/policies/%s/history">Back to history</a></p>
+</body>
+</html>`, html.EscapeString(name), html.EscapeString(name), diff.To, diff.From, fields, lines.String(), name)
+
+	return c.HTML(http.StatusOK, page)
+}
+
+// Restores a revision from the history page
+func RestoreRevisionHandler(c echo.Context) error {
+	name := c.Param("name")
+	n, err := revisionParam(c, "rev")
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	author, note := changeInfo(c, "web", "")
+	if _, err := restoreRevision(name, n, author, note); err != nil {
+		return c.String(http.StatusInternalServerError, "Could not restore revision: "+err.Error())
+	}
+	return c.Redirect(http.StatusSeeOther, "/policies/"+name+"/history")
+}
@@ -0,0 +1,236 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"janeauto/config"
+	"janeauto/db"
+	"janeauto/janetest"
+	"janeauto/models"
+	"janeauto/runner"
+)
+
+// newEcho registers the routes the tests use, the same way main does
+func newEcho() *echo.Echo {
+	e := echo.New()
+	e.GET("/debug-jane", DebugJaneHandler)
+	api := e.Group("/api/v1")
+	api.POST("/policies", APICreatePolicyHandler)
+	api.GET("/policies/:name", APIGetPolicyHandler)
+	api.PUT("/policies/:name", APIUpdatePolicyHandler)
+	api.PATCH("/policies/:name", APIPatchPolicyHandler)
+	api.GET("/policies/:name/revisions", APIListRevisionsHandler)
+	api.GET("/policies/:name/revisions/:rev/diff", APIDiffRevisionHandler)
+	api.POST("/policies/:name/revisions/:rev/restore", APIRestoreRevisionHandler)
+	api.POST("/lint", APILintHandler)
+	api.POST("/runs", APISubmitRunHandler)
+	api.GET("/runs/:id", APIGetRunHandler)
+	return e
+}
+
+// call sends a request to e and decodes the JSON response into out, if given
+func call(t *testing.T, e *echo.Echo, method, path, body string, out interface{}) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: cannot decode %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func fakeJane(t *testing.T) *janetest.Server {
+	t.Helper()
+	srv := janetest.New(t)
+	srv.AddElement("e1", "web01", "prod")
+	srv.AddElement("e2", "web02", "prod")
+	srv.AddIntent("i1", "sys info")
+	srv.AddRule("ok", 0)
+	srv.AddRule("bad", 9001)
+	return srv
+}
+
+func TestLintAPI(t *testing.T) {
+	srv := fakeJane(t)
+	e := newEcho()
+
+	body := fmt.Sprintf(`{"name": "p", "jane": %q, "collection": {"tags": ["prod"]},
+		"attestations": [{"intent": "sys info", "endpoint": "tarzan", "rules": [{"name": "ok"}, {"name": "typo"}]}]}`, srv.URL)
+	var report struct {
+		Issues []struct{ Severity, Field string }
+	}
+	if code := call(t, e, http.MethodPost, "/api/v1/lint", body, &report); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if len(report.Issues) != 1 || report.Issues[0].Field != "attestations[0].rules[1].name" {
+		t.Errorf("got %+v", report.Issues)
+	}
+}
+
+func TestPolicyBodyErrors(t *testing.T) {
+	e := newEcho()
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"name": `, http.StatusBadRequest},
+		{`{"name": "p", "colour": "blue"}`, http.StatusBadRequest},
+		{`{"name": "", "attestations": []}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		var apiErr APIError
+		if code := call(t, e, http.MethodPost, "/api/v1/lint", tt.body, &apiErr); code != tt.code {
+			t.Errorf("%s: got status %d, want %d", tt.body, code, tt.code)
+		}
+		if apiErr.Error == "" {
+			t.Errorf("%s: no error message", tt.body)
+		}
+	}
+	for _, body := range []string{`null`, `[1]`, `"p"`} {
+		var apiErr APIError
+		if code := call(t, e, http.MethodPut, "/api/v1/policies/p", body, &apiErr); code != http.StatusBadRequest || apiErr.Error == "" {
+			t.Errorf("PUT %s: got status %d, %+v", body, code, apiErr)
+		}
+	}
+}
+
+func TestDebugJane(t *testing.T) {
+	srv := fakeJane(t)
+	srv.AddElement("e9", "bobafet")
+	old := config.ConfigData.Jane.URL
+	config.ConfigData.Jane.URL = srv.URL
+	defer func() { config.ConfigData.Jane.URL = old }()
+
+	var out struct {
+		Elements []string `json:"bobafet_elements"`
+	}
+	if code := call(t, newEcho(), http.MethodGet, "/debug-jane", "", &out); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if len(out.Elements) != 1 || out.Elements[0] != "e9" {
+		t.Errorf("got %v", out.Elements)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	var target, patch interface{}
+	json.Unmarshal([]byte(`{"a": 1, "b": {"c": 2, "d": 3}, "e": [1]}`), &target)
+	json.Unmarshal([]byte(`{"b": {"c": null, "x": 4}, "e": [2], "f": "new"}`), &patch)
+
+	got, _ := json.Marshal(mergePatch(target, patch))
+	want := `{"a":1,"b":{"d":3,"x":4},"e":[2],"f":"new"}`
+	if string(got) != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	var got []string
+	for _, l := range diffLines(strings.Fields("a b c d e"), strings.Fields("a x c e f")) {
+		got = append(got, l.Op+l.Text)
+	}
+	want := " a -b +x  c -d  e +f"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got  %q\nwant %q", strings.Join(got, " "), want)
+	}
+}
+
+func TestResultErrorLabels(t *testing.T) {
+	card := renderResultCard(models.AttestationResult{
+		ElementID: "e1",
+		Status:    models.StatusError,
+		Error:     &models.ResultError{Kind: models.ErrorKindCircuitOpen, Message: "circuit breaker is open"},
+	})
+	if !strings.Contains(card, "Error: JANE unavailable (circuit breaker open)") {
+		t.Errorf("result card does not name the circuit breaker:\n%s", card)
+	}
+
+	rule := map[string]interface{}{"error": "circuit breaker is open", "error_kind": models.ErrorKindCircuitOpen}
+	if got, want := ruleExplanation(rule), "JANE unavailable (circuit breaker open): circuit breaker is open"; got != want {
+		t.Errorf("rule: got %q, want %q", got, want)
+	}
+}
+
+// TestPolicyRunEndToEnd stores a policy through the API, edits it, runs it against the fake
+// JANE and restores the first revision. It needs a MongoDB, set JANEAUTO_TEST_MONGO to its URI.
+func TestPolicyRunEndToEnd(t *testing.T) {
+	uri := os.Getenv("JANEAUTO_TEST_MONGO")
+	if uri == "" {
+		t.Skip("JANEAUTO_TEST_MONGO is not set")
+	}
+	dbName := fmt.Sprintf("janeauto_test_%d", time.Now().UnixNano())
+	client := db.Connect(uri, dbName)
+	t.Cleanup(func() {
+		client.Database(dbName).Drop(context.Background())
+	})
+	runner.Start(1, 10, time.Minute)
+
+	srv := fakeJane(t)
+	e := newEcho()
+	policy := fmt.Sprintf(`{"name": "e2e", "jane": %q, "collection": {"tags": ["prod"]},
+		"attestations": [{"intent": "sys info", "endpoint": "tarzan", "rules": [{"name": "ok"}]}]}`, srv.URL)
+	if code := call(t, e, http.MethodPost, "/api/v1/policies", policy, nil); code != http.StatusCreated {
+		t.Fatalf("create: status %d", code)
+	}
+	patch := `{"attestations": [{"intent": "sys info", "endpoint": "tarzan", "rules": [{"name": "ok"}, {"name": "bad"}]}]}`
+	var patched models.Policy
+	if code := call(t, e, http.MethodPatch, "/api/v1/policies/e2e", patch, &patched); code != http.StatusOK {
+		t.Fatalf("patch: status %d", code)
+	}
+	if patched.Revision != 2 || patched.Source != models.SourceAPI {
+		t.Errorf("patched: revision %d source %q", patched.Revision, patched.Source)
+	}
+
+	var submitted models.Run
+	if code := call(t, e, http.MethodPost, "/api/v1/runs", `{"policy": "e2e"}`, &submitted); code != http.StatusAccepted {
+		t.Fatalf("submit: status %d", code)
+	}
+	var got struct {
+		Run     models.Run
+		Results []models.AttestationResult
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		call(t, e, http.MethodGet, "/api/v1/runs/"+submitted.ID, "", &got)
+		if got.Run.Status != models.RunQueued && got.Run.Status != models.RunRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run still %s", got.Run.Status)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got.Run.Verdict != models.VerdictFail || len(got.Results) != 2 || got.Run.Revision != 2 {
+		t.Errorf("run: verdict %s, %d results, revision %d", got.Run.Verdict, len(got.Results), got.Run.Revision)
+	}
+
+	var diff RevisionDiff
+	if code := call(t, e, http.MethodGet, "/api/v1/policies/e2e/revisions/2/diff", "", &diff); code != http.StatusOK {
+		t.Fatalf("diff: status %d", code)
+	}
+	if strings.Join(diff.Fields, ",") != "attestations" {
+		t.Errorf("diff fields: got %v", diff.Fields)
+	}
+
+	var restored models.Policy
+	if code := call(t, e, http.MethodPost, "/api/v1/policies/e2e/revisions/1/restore", "", &restored); code != http.StatusOK {
+		t.Fatalf("restore: status %d", code)
+	}
+	if restored.Revision != 3 || len(restored.Attestations[0].Rules) != 1 {
+		t.Errorf("restored: revision %d with %d rules", restored.Revision, len(restored.Attestations[0].Rules))
+	}
+}